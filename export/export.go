@@ -0,0 +1,156 @@
+// Package export writes the stored responses of a form as csv, json lines or xlsx. Every format has the same columns:
+// the response id, when the response was submitted, and then one column per field, in the order the fields were
+// declared in the form.
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mould/store"
+)
+
+// Column is a single column of an export, either one of the form's fields or one of the columns every export starts
+// with, the response id and the time it was submitted
+type Column struct {
+	Key   string
+	Label string
+}
+
+// Formats lists the formats that can be passed to Write
+var Formats = []string{"csv", "jsonl", "xlsx"}
+
+// ContentTypes maps each format to the content type it is served with
+var ContentTypes = map[string]string{
+	"csv":   "text/csv; charset=utf-8",
+	"jsonl": "application/jsonl; charset=utf-8",
+	"xlsx":  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Columns returns the columns of an export of a form with the given fields
+func Columns(fields []Column) []Column {
+	return append([]Column{{Key: "id", Label: "id"}, {Key: "submitted", Label: "submitted"}}, fields...)
+}
+
+// Write writes entries to w in the given format, with one row for each entry, ordered by when they were submitted
+func Write(w io.Writer, format string, columns []Column, entries []store.Entry) error {
+	entries = append([]store.Entry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Response.Meta().Created.Before(entries[j].Response.Meta().Created)
+	})
+	switch format {
+	case "csv":
+		return WriteCSV(w, columns, entries)
+	case "jsonl":
+		return WriteJSONL(w, columns, entries)
+	case "xlsx":
+		return WriteXLSX(w, columns, entries)
+	}
+	return fmt.Errorf("unknown export format %q: expected one of %v", format, Formats)
+}
+
+// value returns the stored value of a column for a single entry
+func value(column Column, entry store.Entry) interface{} {
+	switch column.Key {
+	case "id":
+		return entry.ID
+	case "submitted":
+		created := entry.Response.Meta().Created
+		if created.IsZero() {
+			return nil
+		}
+		return created.Format(time.RFC3339)
+	}
+	return entry.Response[column.Key]
+}
+
+// text formats a value as a single cell of text. the options of multi-value fields are joined with commas
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		var parts []string
+		for _, part := range v {
+			parts = append(parts, text(part))
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// csvText formats a value as text for a csv cell. spreadsheets opening a csv file run text starting with one of the
+// characters that start a formula, e.g. an answer of =HYPERLINK(...), so such text is prefixed with an apostrophe to
+// have it shown instead. numbers are left alone, so that negative ones stay numbers. xlsx files don't need this, as
+// their text cells are never run
+func csvText(v interface{}) string {
+	s := text(v)
+	if _, isNumber := v.(float64); !isNumber && s != "" && strings.ContainsAny(s[:1], "=+-@\t\r") {
+		return "'" + s
+	}
+	return s
+}
+
+func WriteCSV(w io.Writer, columns []Column, entries []store.Entry) error {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Label
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = csvText(value(column, entry))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSONL writes one json object per entry. the values keep their stored types, e.g. multi-value fields stay lists,
+// and the keys are written in column order rather than the alphabetical order encoding/json would give a map
+func WriteJSONL(w io.Writer, columns []Column, entries []store.Entry) error {
+	for _, entry := range entries {
+		var line bytes.Buffer
+		line.WriteByte('{')
+		for i, column := range columns {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			key, err := json.Marshal(column.Key)
+			if err != nil {
+				return err
+			}
+			val, err := json.Marshal(value(column, entry))
+			if err != nil {
+				return err
+			}
+			line.Write(key)
+			line.WriteByte(':')
+			line.Write(val)
+		}
+		line.WriteString("}\n")
+		if _, err := w.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
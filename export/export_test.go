@@ -0,0 +1,117 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"mould/export"
+	"mould/store"
+)
+
+var columns = export.Columns([]export.Column{
+	{Key: "name", Label: "Name"},
+	{Key: "phone", Label: "Phone"},
+	{Key: "amount", Label: "Amount"},
+	{Key: "toppings", Label: "Toppings"},
+	{Key: "terms", Label: "Terms"},
+})
+
+// entries are two responses, given in the opposite order of when they were submitted
+func entries() []store.Entry {
+	first, second := store.Response{
+		"name":     "=HYPERLINK(\"https://example.org\")",
+		"phone":    "+46 70 123 45 67",
+		"amount":   -3.5,
+		"toppings": []interface{}{"cheese", "olives"},
+		"terms":    true,
+	}, store.Response{
+		"name":  "Ada",
+		"phone": "@home",
+		// amount and toppings were left unanswered
+		"amount": nil,
+		"terms":  false,
+	}
+	first.SetMeta(store.Meta{Created: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)})
+	second.SetMeta(store.Meta{Created: time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)})
+	return []store.Entry{{ID: "b", Response: second}, {ID: "a", Response: first}}
+}
+
+func write(t *testing.T, format string) []byte {
+	var b bytes.Buffer
+	if err := export.Write(&b, format, columns, entries()); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// csv cells that a spreadsheet would run as a formula are escaped, but numbers are left alone
+func TestCSV(t *testing.T) {
+	rows, err := csv.NewReader(bytes.NewReader(write(t, "csv"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"id", "submitted", "Name", "Phone", "Amount", "Toppings", "Terms"},
+		{"a", "2024-05-01T12:00:00Z", "'=HYPERLINK(\"https://example.org\")", "'+46 70 123 45 67", "-3.5", "cheese, olives", "true"},
+		{"b", "2024-05-02T12:00:00Z", "Ada", "'@home", "", "", "false"},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("got %d rows, expected %d: %q", len(rows), len(expected), rows)
+	}
+	for i := range expected {
+		if strings.Join(rows[i], "|") != strings.Join(expected[i], "|") {
+			t.Errorf("row %d: got %q, expected %q", i, rows[i], expected[i])
+		}
+	}
+}
+
+// json lines keep the stored types, with the keys in column order
+func TestJSONL(t *testing.T) {
+	expected := `{"id":"a","submitted":"2024-05-01T12:00:00Z","name":"=HYPERLINK(\"https://example.org\")","phone":"+46 70 123 45 67","amount":-3.5,"toppings":["cheese","olives"],"terms":true}
+{"id":"b","submitted":"2024-05-02T12:00:00Z","name":"Ada","phone":"@home","amount":null,"toppings":null,"terms":false}
+`
+	if got := string(write(t, "jsonl")); got != expected {
+		t.Errorf("got\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+// xlsx cells hold the answers as they are: text that looks like a formula is plain text in an xlsx file, and numbers
+// and booleans get their own cell types
+func TestXLSX(t *testing.T) {
+	b := write(t, "xlsx")
+	archive, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet, err := archive.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sheet.Close()
+	xml, err := io.ReadAll(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range []string{
+		`<c r="C1" t="inlineStr"><is><t xml:space="preserve">Name</t></is></c>`,
+		`<c r="C2" t="inlineStr"><is><t xml:space="preserve">=HYPERLINK(&#34;https://example.org&#34;)</t></is></c>`,
+		`<c r="D2" t="inlineStr"><is><t xml:space="preserve">+46 70 123 45 67</t></is></c>`,
+		`<c r="E2"><v>-3.5</v></c>`,
+		`<c r="F2" t="inlineStr"><is><t xml:space="preserve">cheese, olives</t></is></c>`,
+		`<c r="G2" t="b"><v>1</v></c>`,
+		`<c r="D3" t="inlineStr"><is><t xml:space="preserve">@home</t></is></c>`,
+		`<c r="G3" t="b"><v>0</v></c>`,
+	} {
+		if !strings.Contains(string(xml), cell) {
+			t.Errorf("expected the cell %s in\n%s", cell, xml)
+		}
+	}
+	if strings.Contains(string(xml), `r="E3"`) {
+		t.Errorf("expected no cell for the unanswered amount in\n%s", xml)
+	}
+}
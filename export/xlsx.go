@@ -0,0 +1,117 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"mould/store"
+)
+
+// the fixed parts of a minimal xlsx workbook with a single sheet
+var xlsxFiles = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Responses" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+// WriteXLSX writes a spreadsheet with a single sheet, holding a header row followed by one row per entry. numbers and
+// booleans are written as such, so that they can be summed and filtered on in the spreadsheet
+func WriteXLSX(w io.Writer, columns []Column, entries []store.Entry) error {
+	archive := zip.NewWriter(w)
+	for _, file := range xlsxFiles {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(f, file.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Label
+	}
+	writeRow(&b, 1, header)
+	for i, entry := range entries {
+		row := make([]interface{}, len(columns))
+		for j, column := range columns {
+			row[j] = value(column, entry)
+		}
+		writeRow(&b, i+2, row)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	if _, err = io.WriteString(sheet, b.String()); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func writeRow(b *strings.Builder, rowNumber int, cells []interface{}) {
+	fmt.Fprintf(b, `<row r="%d">`, rowNumber)
+	for i, cell := range cells {
+		ref := fmt.Sprintf("%s%d", columnName(i), rowNumber)
+		switch v := cell.(type) {
+		case nil:
+			continue
+		case float64:
+			fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, ref, text(v))
+		case bool:
+			n := 0
+			if v {
+				n = 1
+			}
+			fmt.Fprintf(b, `<c r="%s" t="b"><v>%d</v></c>`, ref, n)
+		default:
+			fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(b, []byte(stripControl(text(v))))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+}
+
+// columnName returns the spreadsheet name of the i:th column, counting from 0: A, B, ..., Z, AA, AB, ...
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// stripControl removes the control characters that are not allowed in xml, keeping tabs and newlines
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
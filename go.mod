@@ -2,4 +2,7 @@ module mould
 
 go 1.19
 
-require github.com/dave/jennifer v1.6.1 // indirect
+require (
+	github.com/dave/jennifer v1.6.1
+	github.com/mattn/go-sqlite3 v1.14.32
+)
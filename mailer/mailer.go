@@ -0,0 +1,238 @@
+// Package mailer sends mail about a form's responses through an smtp server, e.g. to the addresses declared with
+// form-notify. Like webhook deliveries, every message is written to an outbox file before it is sent, so that a slow or
+// unreachable mail server never holds up the form, and messages survive restarts and are retried with exponential
+// backoff.
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"mould/outbox"
+)
+
+// Config says which smtp server mail is sent through, and who it is sent as
+type Config struct {
+	// Addr is the host:port of the smtp server. port 465 is spoken to over tls from the start, connections on other
+	// ports are upgraded with STARTTLS when the server offers it
+	Addr string
+	// User and Password log in to the server if User is set. net/smtp only sends them over tls, or to localhost
+	User, Password string
+	// From is the address mail is sent from, e.g. "Stickers <stickers@example.org>"
+	From string
+}
+
+// the states of a message: waiting to be sent, sent, or given up on
+const (
+	Pending = outbox.Pending
+	Sent    = "sent"
+	Failed  = outbox.Failed
+)
+
+// Mail is a message to be queued: Text and HTML are the same message as plain text and as html, and ReplyTo is
+// optional
+type Mail struct {
+	To      []string
+	ReplyTo string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Message is a queued mail. its LastResult is why the last attempt failed, if it did
+type Message struct {
+	outbox.Entry
+	To []string `json:"to"`
+	// Data is the message as it is sent to the server, headers and all
+	Data string `json:"data"`
+}
+
+// Outbox queues messages in a json file, and sends them in the background once started. Timeout limits how long a
+// single attempt may take, and like the attempts and backoff of the outbox, it must be set before it is started
+type Outbox struct {
+	*outbox.Outbox[Message, *Message]
+	Timeout time.Duration
+
+	config Config
+	from   *mail.Address
+}
+
+// Open opens the outbox stored at path, sending through the server in config. the file is created when the first
+// message is queued, and messages that were still pending when the outbox was last closed are picked up again once it
+// is started
+func Open(path string, config Config) (*Outbox, error) {
+	if _, _, err := net.SplitHostPort(config.Addr); err != nil {
+		return nil, fmt.Errorf("smtp server %q: expected host:port", config.Addr)
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("mail from %q: %w", config.From, err)
+	}
+	o := &Outbox{Timeout: 30 * time.Second, config: config, from: from}
+	if o.Outbox, err = outbox.Open[Message](path, Sent, o.send); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Enqueue queues a mail to be sent. the message is written to the outbox before Enqueue returns
+func (o *Outbox) Enqueue(m Mail) error {
+	now := time.Now().UTC()
+	id := outbox.NewID()
+	var to []string
+	for _, addr := range m.To {
+		// the addresses often come straight from a respondent, so they are checked before they end up in headers
+		parsed, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("mail to %q: %w", addr, err)
+		}
+		to = append(to, parsed.Address)
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("mail without recipients")
+	}
+	data, err := o.compose(id, now, to, m)
+	if err != nil {
+		return err
+	}
+	return o.Add(Message{Entry: outbox.Entry{ID: id, Created: now}, To: to, Data: string(data)})
+}
+
+// compose writes a mail as a multipart/alternative message with a plain text and an html part
+func (o *Outbox) compose(id string, now time.Time, to []string, m Mail) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err = qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	var recipients []string
+	for _, addr := range to {
+		recipients = append(recipients, (&mail.Address{Address: addr}).String())
+	}
+	header("From", o.from.String())
+	header("To", strings.Join(recipients, ", "))
+	if m.ReplyTo != "" {
+		if replyTo, err := mail.ParseAddress(m.ReplyTo); err == nil {
+			header("Reply-To", replyTo.String())
+		}
+	}
+	// the subject is made from the form's title, which is a single line, but better safe than sorry
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(m.Subject), " ")))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", id, o.from.Address[strings.LastIndex(o.from.Address, "@")+1:]))
+	header("MIME-Version", "1.0")
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()}))
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// send attempts a message. the server rejecting it outright (5xx), e.g. for an address that doesn't exist, won't
+// change by trying again
+func (o *Outbox) send(m Message) (result string, err error) {
+	if err = o.deliver(m); err == nil {
+		return "", nil
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) && smtpErr.Code >= 500 {
+		fmt.Printf("err sending mail to %s, giving up: %s\n", strings.Join(m.To, ", "), err)
+		return "", outbox.Permanent(err)
+	}
+	if m.Attempts+1 >= o.MaxAttempts {
+		fmt.Printf("err sending mail to %s, giving up: %s\n", strings.Join(m.To, ", "), err)
+	} else {
+		fmt.Printf("err sending mail to %s, trying again later: %s\n", strings.Join(m.To, ", "), err)
+	}
+	return "", err
+}
+
+// deliver hands a message to the smtp server
+func (o *Outbox) deliver(m Message) error {
+	host, port, err := net.SplitHostPort(o.config.Addr)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: o.Timeout}
+	var conn net.Conn
+	if port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", o.config.Addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", o.config.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	// net/smtp has no timeouts of its own, and a server that stops answering would otherwise hold up every message
+	// after this one
+	conn.SetDeadline(time.Now().Add(o.Timeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && port != "465" {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if o.config.User != "" {
+		if err = c.Auth(smtp.PlainAuth("", o.config.User, o.config.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(o.from.Address); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write([]byte(m.Data)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,232 @@
+package mailer_test
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mould/mailer"
+)
+
+// smtpServer speaks just enough smtp to take mail from net/smtp. rcpt answers RCPT TO with a reply other than 250,
+// e.g. "550 no such user", and is nil for a server that takes everything
+type smtpServer struct {
+	net.Listener
+	rcpt func(n int) string
+
+	mu         sync.Mutex
+	rcpts      int
+	recipients []string
+	messages   []string
+}
+
+func newSMTPServer(t *testing.T, rcpt func(n int) string) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{Listener: l, rcpt: rcpt}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		io.WriteString(conn, line+"\r\n")
+	}
+	reply("220 localhost fake smtp")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch verb {
+		case "EHLO", "HELO", "MAIL", "RSET", "NOOP":
+			reply("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts++
+			n := s.rcpts
+			s.mu.Unlock()
+			if s.rcpt != nil {
+				if answer := s.rcpt(n); answer != "" {
+					reply(answer)
+					continue
+				}
+			}
+			s.mu.Lock()
+			s.recipients = append(s.recipients, line[strings.Index(line, "<")+1:strings.LastIndex(line, ">")])
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) received() (recipients, messages []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.recipients...), append([]string(nil), s.messages...)
+}
+
+// open opens and starts an outbox in a temporary directory that sends through s
+func open(t *testing.T, s *smtpServer, maxAttempts int, backoff time.Duration) *mailer.Outbox {
+	outbox, err := mailer.Open(filepath.Join(t.TempDir(), "responses.json.mail.json"), mailer.Config{
+		Addr: s.Addr().String(),
+		From: "Stickers <stickers@example.org>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox.MaxAttempts, outbox.Backoff, outbox.MaxBackoff, outbox.Timeout = maxAttempts, backoff, backoff, 5*time.Second
+	outbox.Start()
+	t.Cleanup(func() { outbox.Close() })
+	return outbox
+}
+
+// waitFor waits for the only message in the outbox to reach state
+func waitFor(t *testing.T, outbox *mailer.Outbox, state string) mailer.Message {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		messages := outbox.Items()
+		if len(messages) == 1 && messages[0].State == state {
+			return messages[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the message never became %s: %+v", state, messages)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+var stickers = mailer.Mail{
+	To:      []string{"Ada <ada@example.org>"},
+	ReplyTo: "grace@example.org",
+	Subject: "New response to Stickers",
+	Text:    "Grace would like 3 stickers.",
+	HTML:    "<p>Grace would like 3 stickers.</p>",
+}
+
+// a mail is sent as a multipart message with both of its parts, to the addresses it was queued for
+func TestSend(t *testing.T) {
+	s := newSMTPServer(t, nil)
+	outbox := open(t, s, 8, time.Minute)
+	if err := outbox.Enqueue(stickers); err != nil {
+		t.Fatal(err)
+	}
+	sent := waitFor(t, outbox, mailer.Sent)
+	if sent.Attempts != 1 {
+		t.Errorf("sent after %d attempts, expected 1", sent.Attempts)
+	}
+
+	recipients, messages := s.received()
+	if len(recipients) != 1 || recipients[0] != "ada@example.org" {
+		t.Errorf("got recipients %v, expected [ada@example.org]", recipients)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, expected 1", len(messages))
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"From":     `"Stickers" <stickers@example.org>`,
+		"To":       "<ada@example.org>",
+		"Reply-To": "<grace@example.org>",
+		"Subject":  "New response to Stickers",
+	} {
+		if got := msg.Header.Get(name); got != expected {
+			t.Errorf("got %s %q, expected %q", name, got, expected)
+		}
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for _, expected := range []string{stickers.Text, stickers.HTML} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the quoted-printable encoding is undone by the multipart reader
+		b, _ := io.ReadAll(part)
+		if string(b) != expected {
+			t.Errorf("got part %q, expected %q", b, expected)
+		}
+	}
+}
+
+// a mail the server rejects outright is given up on without trying again
+func TestRejected(t *testing.T) {
+	s := newSMTPServer(t, func(n int) string { return "550 no such user" })
+	outbox := open(t, s, 8, time.Millisecond)
+	if err := outbox.Enqueue(stickers); err != nil {
+		t.Fatal(err)
+	}
+	failed := waitFor(t, outbox, mailer.Failed)
+	if failed.Attempts != 1 || !strings.Contains(failed.LastResult, "550") {
+		t.Errorf("gave up after %d attempts with %q, expected 1 attempt ending in a 550", failed.Attempts, failed.LastResult)
+	}
+}
+
+// a mail the server can't take for now is sent again after the backoff
+func TestRetry(t *testing.T) {
+	s := newSMTPServer(t, func(n int) string {
+		if n <= 2 {
+			return "451 try again later"
+		}
+		return ""
+	})
+	outbox := open(t, s, 8, time.Millisecond)
+	if err := outbox.Enqueue(stickers); err != nil {
+		t.Fatal(err)
+	}
+	sent := waitFor(t, outbox, mailer.Sent)
+	if _, messages := s.received(); sent.Attempts != 3 || len(messages) != 1 {
+		t.Errorf("sent after %d attempts with %d messages received, expected 3 attempts and 1 message", sent.Attempts, len(messages))
+	}
+}
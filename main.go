@@ -5,12 +5,17 @@ import (
 	"bytes"
 	"strings"
 	"html/template"
-	"regexp"
 	"path/filepath"
 	"flag"
-	"bufio"
-	. "github.com/dave/jennifer/jen"
+	"net/http"
+	"mould/mould"
+	"mould/store"
+	"mould/mailer"
+	"mould/export"
 	"os"
+	"time"
+	"errors"
+	"io/fs"
 )
 
 /*
@@ -43,160 +48,449 @@ input[The rabbit boat but backwards]#access-token   = you know it.
 radio[Size]                                         = Small, Medium, Large
 */
 
-func jsonTag (value string) map[string]string {
-	return map[string]string{"json":value}
+func readFileAsString(fp string) (string, bool) {
+	if fp != "" {
+		b, err := os.ReadFile(fp)
+		if err == nil {
+			return string(b), true
+		} else {
+			fmt.Printf("err reading %s", fp)
+			return "", false
+		}
+	}
+	return "", false
 }
 
-type genValue struct {
-	element string
-	title string
-	value string
-	key string
-	required bool
-	options map[string]string
-}
+// runExport implements the export command, which writes the stored responses as csv, json lines or xlsx with the
+// columns in the order the fields are declared in the form format
+func runExport(args []string) {
+	cmd := flag.NewFlagSet("export", flag.ExitOnError)
+	var formatFp, storeKind, storePath, exportFormat, outputFp string
+	cmd.StringVar(&formatFp, "input", "", "the file containing the form format the responses were submitted to")
+	cmd.StringVar(&storeKind, "store", "json", fmt.Sprintf("how the responses are stored, one of %s", strings.Join(store.Kinds, ", ")))
+	cmd.StringVar(&storePath, "store-path", "", "the file the responses are stored in (default depends on --store)")
+	cmd.StringVar(&exportFormat, "format", "", fmt.Sprintf("the format to export, one of %s (default: the extension of --output, else csv)", strings.Join(export.Formats, ", ")))
+	cmd.StringVar(&outputFp, "output", "", "the file to write the export to (default: stdout)")
+	cmd.Parse(args)
+	if formatFp == "" {
+		fmt.Println("must pass --input <file containing form format>")
+		os.Exit(1)
+	}
+	if exportFormat == "" {
+		exportFormat = strings.TrimPrefix(filepath.Ext(outputFp), ".")
+		if exportFormat == "" {
+			exportFormat = "csv"
+		}
+	}
+	if storePath == "" {
+		storePath = store.DefaultPath(storeKind)
+	}
+
+	b, err := os.ReadFile(formatFp)
+	if err != nil {
+		fmt.Println("issue when reading format file", err)
+		os.Exit(1)
+	}
+	form, diagnostics := mould.ParseFormat(formatFp, string(b))
+	if len(diagnostics) > 0 {
+		for _, d := range diagnostics {
+			fmt.Fprintln(os.Stderr, d)
+		}
+		os.Exit(1)
+	}
+	var fields []export.Column
+	for _, field := range form.Fields() {
+		fields = append(fields, export.Column{Key: field.Key, Label: field.Label})
+	}
 
-type Theme struct {
-	background, title, body string
+	responses, err := store.Open(storeKind, storePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "err opening response store", err)
+		os.Exit(1)
+	}
+	defer responses.Close()
+	entries, err := responses.List()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "err listing responses", err)
+		os.Exit(1)
+	}
+	var buf bytes.Buffer
+	if err = export.Write(&buf, exportFormat, export.Columns(fields), entries); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if outputFp == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err = os.WriteFile(outputFp, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d response(s) to %s\n", len(entries), outputFp)
 }
 
-type StyleData struct {
-	Background, TitleColor, Body template.HTML
+// runFmt implements the fmt command, which rewrites form format files in mould's canonical formatting
+func runFmt(args []string) {
+	cmd := flag.NewFlagSet("fmt", flag.ExitOnError)
+	var check, stdout bool
+	cmd.BoolVar(&check, "check", false, "don't rewrite the files, only list those that aren't formatted and exit with status 1 if there are any")
+	cmd.BoolVar(&stdout, "stdout", false, "print the formatted files instead of rewriting them")
+	cmd.Parse(args)
+	if cmd.NArg() == 0 {
+		fmt.Println("must pass the form format files to format, e.g. go run main.go fmt form.mould")
+		os.Exit(1)
+	}
+	failed := false
+	for _, fp := range cmd.Args() {
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		formatted, err := mould.Format(fp, string(b))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		switch {
+		case check:
+			if formatted != string(b) {
+				fmt.Println(fp)
+				failed = true
+			}
+		case stdout:
+			fmt.Print(formatted)
+		case formatted != string(b):
+			if err = store.WriteFileAtomic(fp, []byte(formatted), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
 
-type TemplateData struct {
-	Header, Footer, Content template.HTML
-	Stylesheet template.CSS
-	Title string
+// readPage reads the html and css files declared with --html-header, --html-footer, --stylesheet and --html-receipt.
+// the stylesheet *fully* replaces mould's default styling, and the receipt the generated receipt
+func readPage(headerFp, footerFp, stylesheetFp, receiptFp string) mould.Page {
+	var page mould.Page
+	page.Header, _ = readFileAsString(headerFp)
+	page.Footer, _ = readFileAsString(footerFp)
+	page.Stylesheet, _ = readFileAsString(stylesheetFp)
+	page.Receipt, _ = readFileAsString(receiptFp)
+	return page
 }
 
-var stylesheetTemplate = `<style>
-		html {
-			{{ if .Background }} background: {{ .Background }}; {{ end }}
-			{{ if .Body }} color: {{ .Body }}; {{ end }}
-			padding-left: 2rem;
-			padding-right: 2rem;
-			padding-top: 1rem;
-		}
-		h1 {
-			{{ if .TitleColor }} color: {{ .TitleColor }}; {{ end }}
-		}
-		* {
-			padding: 0;
-			margin-bottom: 0.5rem;
+// watchFiles calls changed every time one of the files is modified, created or removed, checking every interval.
+// empty paths are ignored
+func watchFiles(files []string, interval time.Duration, changed func()) {
+	modTimes := make(map[string]time.Time)
+	check := func() bool {
+		modified := false
+		for _, fp := range files {
+			if fp == "" {
+				continue
+			}
+			// a file that is missing has a zero modification time, so that it counts as changed once it shows up
+			var modTime time.Time
+			if info, err := os.Stat(fp); err == nil {
+				modTime = info.ModTime()
+			}
+			if last, seen := modTimes[fp]; !seen || !modTime.Equal(last) {
+				modified = modified || seen
+				modTimes[fp] = modTime
+			}
 		}
-		div {
-			display: grid;
-			max-width: 600px;
-			align-items: center;
+		return modified
+	}
+	check()
+	for range time.Tick(interval) {
+		if check() {
+			changed()
 		}
-</style>
-`
+	}
+}
 
-func parseFormat(format string) []genValue {
-	pattern := regexp.MustCompile(`(form-\w+)|([!]?)(\S*)(\[.*\])([#]\S+)?`)
-	scanner := bufio.NewScanner(strings.NewReader(format))
-	var genList []genValue
-	for scanner.Scan() {
-		line := scanner.Text()
-		splitterIndex := strings.Index(line, "=")
-		left := strings.TrimSpace(line[0:splitterIndex])
+// runInterpreted implements the run command, which serves a single form straight from its form format: the form is
+// parsed when the server starts, so changing it doesn't require generating code and rebuilding the server
+func runInterpreted(args []string) {
+	cmd := flag.NewFlagSet("run", flag.ExitOnError)
+	var formatFp, headerFp, footerFp, stylesheetFp, receiptFp, storeKind, storePath, tokensFp string
+	var port int
+	var keepRevisions, watch bool
+	var smtp mailer.Config
+	var publicURL string
+	cmd.StringVar(&formatFp, "input", "", "a file containing the form format to serve")
+	cmd.StringVar(&headerFp, "html-header", "", "a single html file containing all of the html that will be presented immediately above the form contents")
+	cmd.StringVar(&footerFp, "html-footer", "", "a single html file containing all of the html that will be presented immediately below the form contents")
+	cmd.StringVar(&receiptFp, "html-receipt", "", "a single html template file that replaces the receipt page shown to respondents after submitting")
+	cmd.StringVar(&stylesheetFp, "stylesheet", "", "a single css file containing styles that will be applied to the form (fully replaces mould's default styling)")
+	cmd.IntVar(&port, "port", 7272, "the port to serve the form server on")
+	cmd.StringVar(&storeKind, "store", "json", fmt.Sprintf("how responses are stored, one of %s", strings.Join(store.Kinds, ", ")))
+	cmd.StringVar(&storePath, "store-path", "", "the file responses are stored in (default depends on --store: latest-form-data.json, form-data.jsonl or form-data.sqlite)")
+	cmd.BoolVar(&keepRevisions, "revisions", true, "keep the earlier answers of a response when it is changed, so its history can be seen in the admin pages")
+	cmd.StringVar(&tokensFp, "api-tokens", "", "a file of api tokens, one per line, that give access to the responses at /api/ along with the form's form-api-tokens")
+	cmd.BoolVar(&watch, "watch", true, "reload the form when the form format, or any of the html and css files passed, changes")
+	mould.MailFlags(cmd, &smtp, &publicURL)
+	cmd.Parse(args)
+	if formatFp == "" {
+		fmt.Println("must pass --input <file containing form format>")
+		os.Exit(1)
+	}
+	if storePath == "" {
+		storePath = store.DefaultPath(storeKind)
+	}
+	responses, err := store.Open(storeKind, storePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "err opening response store", err)
+		os.Exit(1)
+	}
+	defer responses.Close()
+	fmt.Printf("Storing responses in %s (%s)\n", storePath, storeKind)
+	outbox, err := mould.OpenWebhooks(storePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "err opening webhook outbox", err)
+		os.Exit(1)
+	}
+	defer outbox.Close()
+	mail, err := mould.OpenMail(storePath, smtp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "err opening mail outbox", err)
+		os.Exit(1)
+	}
+	if mail != nil {
+		defer mail.Close()
+	}
 
-		var v genValue 
-		v.value = strings.TrimSpace(line[splitterIndex+1:])
-		matches := pattern.FindStringSubmatch(left)
-		if len(matches) > 2 && matches[2] == "!" {
-			v.required = true
+	// load reads the form and the files around it into a handler for them, keeping the same response store
+	load := func() (*mould.Handler, error) {
+		b, err := os.ReadFile(formatFp)
+		if err != nil {
+			return nil, fmt.Errorf("issue when reading format file: %w", err)
+		}
+		form, diagnostics := mould.ParseFormat(formatFp, string(b))
+		if len(diagnostics) > 0 {
+			var problems []string
+			for _, d := range diagnostics {
+				problems = append(problems, d.String())
+			}
+			return nil, fmt.Errorf("%s\nfound %d problem(s) in %s", strings.Join(problems, "\n"), len(diagnostics), formatFp)
 		}
-		if matches[1] != "" {
-			v.element = strings.TrimSpace(matches[1])
-		} else if matches[3] != "" {
-			v.element = strings.TrimSpace(matches[3])
+		index, receipt := form.RenderHTML(readPage(headerFp, footerFp, stylesheetFp, receiptFp))
+		handler, err := mould.NewHandler(form, index, receipt, responses)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", formatFp, err)
 		}
-		if len(matches) > 4 && matches[4] != "" {
-			// get everything except [thing] brackets
-			v.title = matches[4][1:len(matches[4])-1]
+		handler.KeepRevisions = keepRevisions
+		handler.Webhooks = outbox
+		handler.Mail = mail
+		handler.PublicURL = publicURL
+		if warning := form.MailWarning(mail, publicURL); warning != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", formatFp, warning)
 		}
-		if len(matches) > 5 && matches[5] != "" {
-			// remove initial #
-			v.key = strings.TrimSpace(matches[5][1:])
+		if handler.APITokens, err = mould.ReadTokensFile(tokensFp); err != nil {
+			// when watching, the tokens file can be created later on
+			if !watch || !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			fmt.Printf("%s doesn't exist (yet), only the form's own api tokens are accepted until it does\n", tokensFp)
 		}
-		genList = append(genList, v)
+		return handler, nil
+	}
+	handler, err := load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, "not serving the form")
+		os.Exit(1)
+	}
+	live := mould.NewLiveHandler(handler)
+	if watch {
+		// a form that doesn't parse after a change is reported, and the previous version is served until it's fixed
+		go watchFiles([]string{formatFp, headerFp, footerFp, stylesheetFp, receiptFp, tokensFp}, time.Second, func() {
+			handler, err := load()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, "still serving the previous version of the form")
+				return
+			}
+			live.Swap(handler)
+			fmt.Printf("Reloaded %s\n", formatFp)
+		})
 	}
-	return genList
-}
 
-var htmlTemplate = `<!DOCTYPE html>
-<html>
-	<head>
-		<title>{{ .Title }}</title>
-		{{ if .Stylesheet }} 
-		<style>
-			{{ .Stylesheet }} 
-		</style>
-		{{ end }}
-	</head>
-	<body>
-	{{ if .Header }} {{ .Header }} {{ end }}
-	{{ .Content }}
-	{{ if .Footer }} {{ .Footer }} {{ end }}
-	</body>
-</html>`
+	portstr := fmt.Sprintf(":%d", port)
+	fmt.Println("Listening on port: ", portstr)
+	if err = http.ListenAndServe(portstr, live); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-var responseTemplate = `<!DOCTYPE html>
-<html>
-    <head>
-    <title>Form submitted</title>
-		%SENTINEL%
-    <body>
-			<h1>Response successful</h1>
-			<p>Your response: </p>
-			<pre>
-			<code>
-{{ .Data }}
-			</code>
-			</pre>
-			<p><b>Bookmark this page</b> as a receipt or if you want to review what you responded some time in the future</p>
-	</body>
-</html>`
+// runServe implements the serve command, which serves every form in a directory from a single server: each
+// <slug>.mould file is served at /f/<slug>/, with its responses in their own store
+func runServe(args []string) {
+	cmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	var formsDir, dataDir, storeKind, tokensFp string
+	var port int
+	var keepRevisions bool
+	var smtp mailer.Config
+	var publicURL string
+	cmd.StringVar(&formsDir, "forms", "", "a directory of .mould form format files, optionally with <slug>.header.html, <slug>.footer.html, <slug>.css and <slug>.receipt.html next to them")
+	cmd.StringVar(&dataDir, "data", ".", "the directory each form's responses are stored in, as <slug>.<extension of --store>")
+	cmd.StringVar(&storeKind, "store", "json", fmt.Sprintf("how responses are stored, one of %s", strings.Join(store.Kinds, ", ")))
+	cmd.IntVar(&port, "port", 7272, "the port to serve the forms on")
+	cmd.BoolVar(&keepRevisions, "revisions", true, "keep the earlier answers of a response when it is changed, so its history can be seen in the admin pages")
+	cmd.StringVar(&tokensFp, "api-tokens", "", "a file of api tokens, one per line, that give access to the responses of every form at /f/<slug>/api/ along with each form's form-api-tokens")
+	mould.MailFlags(cmd, &smtp, &publicURL)
+	cmd.Parse(args)
+	if formsDir == "" {
+		fmt.Println("must pass --forms <directory containing .mould files>")
+		os.Exit(1)
+	}
+	formFps, err := filepath.Glob(filepath.Join(formsDir, "*.mould"))
+	if err != nil || len(formFps) == 0 {
+		fmt.Fprintf(os.Stderr, "found no .mould files in %s\n", formsDir)
+		os.Exit(1)
+	}
+	if err = os.MkdirAll(dataDir, 0777); err != nil {
+		fmt.Fprintln(os.Stderr, "err creating data directory", err)
+		os.Exit(1)
+	}
+	apiTokens, err := mould.ReadTokensFile(tokensFp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "err reading api tokens", err)
+		os.Exit(1)
+	}
 
-func formatKeyAndTitle(v genValue) (string, string) {
-	key := strings.ToLower(v.title)
-	title := strings.ReplaceAll(strings.Title(v.title), " ", "")
-	if len(v.key) > 0 {
-		key = v.key
-		title = strings.ReplaceAll(strings.Title(strings.ReplaceAll(v.key, "-", " ")), " ", "")
-	}
-	return key, title
-}
+	mux := http.NewServeMux()
+	var listing []string
+	for _, formFp := range formFps {
+		slug := strings.TrimSuffix(filepath.Base(formFp), ".mould")
+		// companion files share the form's slug, e.g. stickers.header.html next to stickers.mould
+		companion := func(suffix string) string {
+			fp := filepath.Join(formsDir, slug+suffix)
+			if _, err := os.Stat(fp); err != nil {
+				return ""
+			}
+			str, _ := readFileAsString(fp)
+			return str
+		}
+		b, err := os.ReadFile(formFp)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "issue when reading format file", err)
+			os.Exit(1)
+		}
+		form, diagnostics := mould.ParseFormat(formFp, string(b))
+		if len(diagnostics) > 0 {
+			for _, d := range diagnostics {
+				fmt.Fprintln(os.Stderr, d)
+			}
+			fmt.Fprintf(os.Stderr, "found %d problem(s) in %s, not serving any forms\n", len(diagnostics), formFp)
+			os.Exit(1)
+		}
+		index, receipt := form.RenderHTML(mould.Page{Header: companion(".header.html"), Footer: companion(".footer.html"), Stylesheet: companion(".css"), Receipt: companion(".receipt.html")})
 
-func readFileAsString(fp string) (string, bool) {
-	if fp != "" {
-		b, err := os.ReadFile(fp)
-		if err == nil {
-			return string(b), true
-		} else {
-			fmt.Printf("err reading %s", fp)
-			return "", false
+		storePath := filepath.Join(dataDir, slug+filepath.Ext(store.DefaultPath(storeKind)))
+		responses, err := store.Open(storeKind, storePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "err opening response store", err)
+			os.Exit(1)
+		}
+		defer responses.Close()
+		outbox, err := mould.OpenWebhooks(storePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "err opening webhook outbox", err)
+			os.Exit(1)
+		}
+		defer outbox.Close()
+		mail, err := mould.OpenMail(storePath, smtp)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "err opening mail outbox", err)
+			os.Exit(1)
+		}
+		if mail != nil {
+			defer mail.Close()
+		}
+		if warning := form.MailWarning(mail, publicURL); warning != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", formFp, warning)
+		}
+		handler, err := mould.NewHandler(form, index, receipt, responses)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", formFp, err)
+			os.Exit(1)
+		}
+		handler.KeepRevisions = keepRevisions
+		handler.APITokens = apiTokens
+		handler.Webhooks = outbox
+		handler.Mail = mail
+		handler.PublicURL = publicURL
+		handler.Base = "/f/" + slug
+		mux.Handle(handler.Base+"/", handler)
+
+		title := form.Title
+		if title == "" {
+			title = slug
 		}
+		listing = append(listing, fmt.Sprintf(`<li><a href="%s/">%s</a></li>`, handler.Base, template.HTMLEscapeString(title)))
+		fmt.Printf("Serving %s at %s/, storing responses in %s (%s)\n", formFp, handler.Base, storePath, storeKind)
+	}
+	mux.HandleFunc("/", func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(res, req)
+			return
+		}
+		fmt.Fprintf(res, "<!DOCTYPE html>\n<html>\n<head><title>Forms</title></head>\n<body>\n<h1>Forms</h1>\n<ul>\n%s\n</ul>\n</body>\n</html>", strings.Join(listing, "\n"))
+	})
+
+	portstr := fmt.Sprintf(":%d", port)
+	fmt.Println("Listening on port: ", portstr)
+	if err = http.ListenAndServe(portstr, mux); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	return "", false
 }
 
+// formPackageName is the package the generate command writes the form's Go code to, which server.go imports as
+// mould/myform
 const formPackageName = "myform"
+
 func main() {
-	var htmlList []string
-	var theme Theme
-	var setPassword string
-	setUser := "mouldy" // default user is "mouldy". only used if password is set, and can be changed with `form-user`
-	var pageTitle string
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		runExport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		runFmt(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		runInterpreted(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+
 	var formatFp string
 	var stylesheetFp string
 	var headerFp, footerFp string
 	flag.StringVar(&headerFp, "html-header", "", "a single html file containing all of the html that will be presented immediately above the form contents")
 	flag.StringVar(&footerFp, "html-footer", "", "a single html file containing all of the html that will be presented immediately below the form contents")
+	var receiptFp string
+	flag.StringVar(&receiptFp, "html-receipt", "", "a single html template file that replaces the receipt page shown to respondents after submitting (see the README for the data it is rendered with)")
 	flag.StringVar(&stylesheetFp, "stylesheet", "", "a single css file containing styles that will be applied to the form (fully replaces mould's default styling)")
 	flag.StringVar(&formatFp, "input", "", "a file containing the form format to generate a form server using")
+	var schemaFp string
+	flag.StringVar(&schemaFp, "json-schema", "", "also write a JSON Schema describing the stored answers to this file")
+	var typescriptFp, openapiFp string
+	flag.StringVar(&typescriptFp, "typescript", "", "also write typescript interfaces for the stored answers to this file")
+	flag.StringVar(&openapiFp, "openapi", "", "also write an OpenAPI document describing the form server's endpoints to this file")
 	flag.Parse()
 	if formatFp == "" {
 		fmt.Println("must pass --input <file containing form format>")
@@ -208,162 +502,29 @@ func main() {
 	}
 	format := string(b)
 
-	values := parseFormat(format)
-
-	f := NewFile(formPackageName)
-	var contentBits []Code
-	var answer []Code
-	var resParse []Code
-	for _, input := range values {
-		switch input.element {
-		case "form-title":
-			contentBits = append(contentBits, Id("Title").String())
-			htmlList = append(htmlList, fmt.Sprintf(`<h1>%s</h1>`, input.value))
-			pageTitle = input.value
-		case "form-desc":
-			contentBits = append(contentBits, Id("Description").String())
-			htmlList = append(htmlList, fmt.Sprintf(`<p>%s</p>`, input.value))
-		case "form-image":
-			contentBits = append(contentBits, Id("Image").String())
-			htmlList = append(htmlList, fmt.Sprintf(`<img src="%s">`, input.value))
-		case "form-password":
-			setPassword = input.value
-			// information used for basic auth, limiting access to the form
-			contentBits = append(contentBits, Id("Password").String())
-		case "form-user":
-			setUser = input.value
-			// information used for basic auth, limiting access to the form
-			contentBits = append(contentBits, Id("User").String())
-		case "form-bg":
-			theme.background = input.value
-		case "form-titlecolor":
-			theme.title = input.value
-		case "form-fg":
-			theme.body = input.value
+	form, diagnostics := mould.ParseFormat(formatFp, format)
+	if len(diagnostics) > 0 {
+		for _, d := range diagnostics {
+			fmt.Fprintln(os.Stderr, d)
 		}
+		fmt.Fprintf(os.Stderr, "found %d problem(s) in %s, nothing was generated\n", len(diagnostics), formatFp)
+		os.Exit(1)
 	}
-
-	htmlList = append(htmlList, `<form action="/" method="post">`)
-	for _, input := range values {
-			var required string 
-			if input.required {
-				required = `required`
-			}
-		switch input.element {
-		case "textarea":
-			key, title := formatKeyAndTitle(input)
-			htmlList = append(htmlList, "<div>")
-			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, title))
-			el := fmt.Sprintf(`<textarea %s placeholder="%s" name="%s"></textarea>`, required, input.value, key)
-			htmlList = append(htmlList, el)
-			htmlList = append(htmlList, "</div>")
-			answer = append(answer, Id(title).String().Tag(jsonTag(key)))
-			resParse = append(resParse, Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(Lit(key)))
-		case "input":
-			key, title := formatKeyAndTitle(input)
-			htmlList = append(htmlList, "<div>")
-			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, input.title))
-			el := fmt.Sprintf(`<input type="text" %s placeholder="%s" name="%s"/>`, required, input.value, key)
-			htmlList = append(htmlList, el)
-			htmlList = append(htmlList, "</div>")
-			answer = append(answer, Id(title).String().Tag(jsonTag(key)))
-			resParse = append(resParse, Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(Lit(key)))
-		case "hidden":
-			key, title := formatKeyAndTitle(input)
-			htmlList = append(htmlList, "<div>")
-			el := fmt.Sprintf(`<input type="hidden" %s value="%s" name="%s"/>`, required, input.value, key)
-			htmlList = append(htmlList, el)
-			htmlList = append(htmlList, "</div>")
-			answer = append(answer, Id(title).String().Tag(jsonTag(key)))
-			resParse = append(resParse, Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(Lit(key)))
-		case "form-paragraph":
-			htmlList = append(htmlList, fmt.Sprintf(`<p>%s</p>`, input.value))
-		case "email":
-			key, title := formatKeyAndTitle(input)
-			htmlList = append(htmlList, "<div>")
-			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, input.title))
-			el := fmt.Sprintf(`<input type="email" %s placeholder="email@provider.tld" pattern="%s", name="%s"/>`, required, input.value, key)
-			htmlList = append(htmlList, el)
-			htmlList = append(htmlList, "</div>")
-			answer = append(answer, Id(title).String().Tag(jsonTag(key)))
-			resParse = append(resParse, Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(Lit(key)))
-		case "number":
-			optionsList := strings.Split(input.value, ",")
-			var options string
-			htmlList = append(htmlList, "<div>")
-			for _, optionPair := range optionsList {
-				optionPair = strings.TrimSpace(optionPair)
-				parts := strings.Split(optionPair, "=")
-				options += fmt.Sprintf(`%s="%s" `,parts[0], parts[1])
-			}
-			key, title := formatKeyAndTitle(input)
-			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, title))
-			el := fmt.Sprintf(`<input type="number" %s %s name="%s"/>`, required, options, key)
-			htmlList = append(htmlList, el)
-			htmlList = append(htmlList, "</div>")
-			answer = append(answer, Id(title).String().Tag(jsonTag(key)))
-			resParse = append(resParse, Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(Lit(key)))
-		case "range":
-			optionsList := strings.Split(input.value, ",")
-			var options string
-			htmlList = append(htmlList, "<div>")
-			for _, optionPair := range optionsList {
-				optionPair = strings.TrimSpace(optionPair)
-				parts := strings.Split(optionPair, "=")
-				options += fmt.Sprintf(`%s="%s" `,parts[0], parts[1])
-			}
-			key, title := formatKeyAndTitle(input)
-			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, title))
-			el := fmt.Sprintf(`<input type="range" %s %s name="%s"/>`, required, options, key)
-			htmlList = append(htmlList, el)
-			htmlList = append(htmlList, "</div>")
-			answer = append(answer, Id(title).String().Tag(jsonTag(key)))
-			resParse = append(resParse, Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(Lit(key)))
-		case "radio":
-			options := strings.Split(input.value, ",")
-			key, title := formatKeyAndTitle(input)
-
-			htmlList = append(htmlList, "<div>")
-			htmlList = append(htmlList, fmt.Sprintf(`<span>%s</span>`, input.title))
-			for i, val := range options {
-				options[i] = strings.TrimSpace(val)
-				radioValue := strings.ToLower(options[i])
-				radioId := fmt.Sprintf(`%s-option-%s`, key, radioValue)
-				htmlList = append(htmlList, "<span>")
-				el := fmt.Sprintf(`<input type="radio" %s id="%s" value="%s" name="%s"/>`, required, radioId, radioValue, key)
-				htmlList = append(htmlList, el)
-				htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, radioId, options[i]))
-				htmlList = append(htmlList, "</span>")
-
-			}
-			htmlList = append(htmlList, "</div>")
-			answer = append(answer, Id(title).String().Tag(jsonTag(key)))
-			resParse = append(resParse, Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(Lit(key)))
+	// a receipt template that was declared fully replaces the generated receipt
+	page := readPage(headerFp, footerFp, stylesheetFp, receiptFp)
+	if page.Receipt != "" {
+		if _, err := template.New("").Parse(page.Receipt); err != nil {
+			fmt.Fprintf(os.Stderr, "%s is not a valid template, nothing was generated: %s\n", receiptFp, err)
+			os.Exit(1)
 		}
 	}
 
-	htmlList = append(htmlList, `<div><button type="submit">Submit</button></div>`)
-	htmlList = append(htmlList, "</form>")
-
-	// set BasicPassword const
-	f.Const().Id("BasicPassword").Op("=").Lit(setPassword)
-	f.Const().Id("BasicUser").Op("=").Lit(setUser)
-	// generate FormContent struct
-	f.Type().Id("FormContent").Struct(contentBits...)
-	// generate FormAnswer struct
-	f.Type().Id("FormAnswer").Struct(answer...)
-
-	// generate FormAnswer.ParsePost() 
-	f.Func().Params(
-		Id("answer").Id("*FormAnswer"),
-	).Id("ParsePost").Params(
-		Id("req").Op("*").Qual("net/http", "Request"),
-	).Block(resParse...)
-
-	// generate ResponderData struct
-	f.Type().Id("ResponderData").Struct(Id("Data").String())
-
-	fmt.Printf("%#v", f)
+	var code bytes.Buffer
+	if err = form.GenerateGo(&code, formPackageName); err != nil {
+		fmt.Fprintln(os.Stderr, "err generating the form model", err)
+		os.Exit(1)
+	}
+	fmt.Print(code.String())
 
 	// make sure the package folder will exist
 	err = os.MkdirAll(formPackageName, 0777)
@@ -371,57 +532,42 @@ func main() {
 		fmt.Println("err mkdirall", err)
 	}
 	// write the generated form model to disk
-	generatedCode := fmt.Sprintf("%#v", f)
-	genCodeErr := os.WriteFile(filepath.Join(formPackageName, "generated-form-model.go"), []byte(generatedCode), 0777)
+	genCodeErr := os.WriteFile(filepath.Join(formPackageName, "generated-form-model.go"), code.Bytes(), 0777)
 	if genCodeErr != nil {
 		fmt.Println(genCodeErr)
 	}
-	var data TemplateData
-	data.Title = pageTitle
-	data.Content = template.HTML(strings.Join(htmlList, "\n"))
 
-	var styleData StyleData
-	if theme.background != "" {
-		styleData.Background = template.HTML(theme.background)
-	}
-	if theme.body != "" {
-		styleData.Body = template.HTML(theme.body)
+	if schemaFp != "" {
+		schema, err := form.JSONSchema()
+		if err == nil {
+			err = os.WriteFile(schemaFp, schema, 0644)
+		}
+		if err != nil {
+			fmt.Println("err writing json schema", err)
+		}
 	}
-	if theme.title != "" {
-		styleData.TitleColor = template.HTML(theme.title)
+	if typescriptFp != "" {
+		err = os.WriteFile(typescriptFp, []byte(form.TypeScript()), 0644)
+		if err != nil {
+			fmt.Println("err writing typescript", err)
+		}
 	}
-
-	// stylesheet was passed with --stylesheet command: try to read it and then 
-	// *fully* replace the contents of stylesheetTemplate with the passed in style
-	if str, ok := readFileAsString(stylesheetFp); ok {
-		data.Stylesheet = template.CSS(str)
-		responseTemplate = strings.ReplaceAll(responseTemplate, "%SENTINEL%", fmt.Sprintf(`<style>%s</style>`, str))
-	} else {
-		// render the stylesheet 
-		t := template.Must(template.New("").Parse(stylesheetTemplate))
-		var styleBuf bytes.Buffer
-		t.Execute(&styleBuf, styleData)
-		data.Stylesheet = template.CSS(styleBuf.String())
-		responseTemplate = strings.ReplaceAll(responseTemplate, "%SENTINEL%", fmt.Sprintf(`<style>%s</style>`, styleBuf.String()))
-	}
-	// read any html header file that was declared
-	if str, ok := readFileAsString(headerFp); ok {
-		data.Header = template.HTML(str)
-	}
-	// read any html footer file that was declared
-	if str, ok := readFileAsString(footerFp); ok {
-		data.Footer = template.HTML(str)
+	if openapiFp != "" {
+		document, err := form.OpenAPI()
+		if err == nil {
+			err = os.WriteFile(openapiFp, document, 0644)
+		}
+		if err != nil {
+			fmt.Println("err writing openapi document", err)
+		}
 	}
 
-	var buf bytes.Buffer
-	// write the page htmlList
-	t := template.Must(template.New("").Parse(htmlTemplate))
-	t.Execute(&buf, data)
-	indexWriteErr := os.WriteFile("index-template.html", buf.Bytes(), 0777)
+	index, receipt := form.RenderHTML(page)
+	indexWriteErr := os.WriteFile("index-template.html", []byte(index), 0777)
 	if indexWriteErr != nil {
 		fmt.Println(indexWriteErr)
 	}
-	indexWriteErr = os.WriteFile("response-template.html", []byte(responseTemplate), 0777)
+	indexWriteErr = os.WriteFile("response-template.html", []byte(receipt), 0777)
 	if indexWriteErr != nil {
 		fmt.Println(indexWriteErr)
 	}
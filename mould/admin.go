@@ -0,0 +1,572 @@
+package mould
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"mould/export"
+	"mould/store"
+)
+
+var adminStyle = `<style>
+	html { font-family: sans-serif; padding: 1rem 2rem; }
+	table { border-collapse: collapse; }
+	th, td { border: 1px solid #ccc; padding: 0.25rem 0.5rem; text-align: left; vertical-align: top; }
+	th a { color: inherit; }
+	form div { display: grid; max-width: 600px; margin-bottom: 0.5rem; }
+	.error { color: firebrick; }
+</style>`
+
+var adminListTemplate = `<!DOCTYPE html>
+<html>
+	<head>
+		<title>Responses</title>
+		` + adminStyle + `
+	</head>
+	<body>
+		<h1>Responses</h1>
+		<form method="get" action="{{ .Base }}/admin/">
+			<input type="search" name="q" value="{{ .Query }}" placeholder="Filter responses"/>
+			<input type="hidden" name="sort" value="{{ .Sort }}"/>
+			<input type="hidden" name="order" value="{{ .Order }}"/>
+			<button type="submit">Filter</button>
+		</form>
+		<p>{{ .Total }} response(s){{ if .Query }} matching <q>{{ .Query }}</q>{{ end }}</p>
+		<p>Download all responses as <a href="{{ .Base }}/admin/export.csv">csv</a>, <a href="{{ .Base }}/admin/export.xlsx">xlsx</a> or <a href="{{ .Base }}/admin/export.jsonl">json lines</a></p>
+		{{ if .HasWebhooks }}<p><a href="{{ .Base }}/admin/webhooks">Webhook deliveries</a></p>{{ end }}
+		<table>
+			<thead>
+				<tr>
+					<th><a href="{{ .SortURL "id" }}">id{{ .SortArrow "id" }}</a></th>
+					<th><a href="{{ .SortURL "submitted" }}">submitted{{ .SortArrow "submitted" }}</a></th>
+					{{ if .HasStatus }}<th><a href="{{ .SortURL "status" }}">status{{ .SortArrow "status" }}</a></th>{{ end }}
+					{{ range .Fields }}<th><a href="{{ $.SortURL .Key }}">{{ .Label }}{{ $.SortArrow .Key }}</a></th>{{ end }}
+				</tr>
+			</thead>
+			<tbody>
+				{{ range .Rows }}
+				<tr>
+					<td><a href="{{ $.Base }}/admin/response/{{ .ID }}">{{ .ID }}</a></td>
+					<td>{{ .Submitted }}</td>
+					{{ if $.HasStatus }}<td>{{ .Status }}</td>{{ end }}
+					{{ range .Cells }}<td>{{ . }}</td>{{ end }}
+				</tr>
+				{{ end }}
+			</tbody>
+		</table>
+		<p>
+			{{ if .PrevURL }}<a href="{{ .PrevURL }}">&larr; previous</a>{{ end }}
+			page {{ .Page }} of {{ .Pages }}
+			{{ if .NextURL }}<a href="{{ .NextURL }}">next &rarr;</a>{{ end }}
+		</p>
+	</body>
+</html>`
+
+var adminDetailTemplate = `<!DOCTYPE html>
+<html>
+	<head>
+		<title>Response {{ .ID }}</title>
+		` + adminStyle + `
+	</head>
+	<body>
+		<h1>Response {{ .ID }}</h1>
+		<p>
+			Submitted {{ .Submitted }}{{ if .Updated }}, last changed {{ .Updated }}{{ end }}
+			{{ if .OldForm }}<br/><span class="error">Submitted to an earlier version of the form, some answers may not match its current fields</span>{{ end }}
+		</p>
+		{{ if .Error }}<p class="error">{{ .Error }}</p>{{ end }}
+		{{ if .Saved }}<p>Saved!</p>{{ end }}
+		<form method="post">
+			{{ range .Fields }}
+			<div>
+				<label for="{{ .Key }}">{{ .Label }}</label>
+				{{ if eq .Element "checkbox" }}
+				<input type="checkbox" id="{{ .Key }}" name="{{ .Key }}" {{ if eq .Value "true" }}checked{{ end }}/>
+				{{ else if eq .Element "textarea" }}
+				<textarea id="{{ .Key }}" name="{{ .Key }}">{{ .Value }}</textarea>
+				{{ else }}
+				<input type="text" id="{{ .Key }}" name="{{ .Key }}" value="{{ .Value }}"/>
+				{{ end }}
+			</div>
+			{{ end }}
+			<div><button type="submit" name="action" value="save">Save changes</button></div>
+		</form>
+		{{ if .Statuses }}
+		<form method="post">
+			<div>
+				<label for="status">Status</label>
+				<select id="status" name="status">
+					{{ range .Statuses }}<option {{ if eq . $.Status }}selected{{ end }}>{{ . }}</option>{{ end }}
+				</select>
+			</div>
+			<div>
+				<label for="message">Message to the respondent (optional)</label>
+				<textarea id="message" name="message"></textarea>
+			</div>
+			<div><button type="submit" name="action" value="status">Change status</button></div>
+		</form>
+		{{ end }}
+		{{ if .Revisions }}
+		<p>Earlier versions of this response:</p>
+		{{ range .Revisions }}
+		<details>
+			<summary>Replaced {{ .Replaced }}{{ if .By }} by {{ .By }}{{ end }}</summary>
+			<pre><code>{{ .Answers }}</code></pre>
+		</details>
+		{{ end }}
+		{{ end }}
+		{{ if .Other }}
+		<p>Other data stored with this response:</p>
+		<pre><code>{{ .Other }}</code></pre>
+		{{ end }}
+		<form method="post" onsubmit="return confirm('Delete this response? This can not be undone.')">
+			<button type="submit" name="action" value="delete">Delete response</button>
+		</form>
+		<p><a href="{{ .Base }}/responder/{{ .ID }}">See the respondent's view</a> &middot; <a href="{{ .Base }}/admin/">Back to all responses</a></p>
+	</body>
+</html>`
+
+var adminList = template.Must(template.New("admin-list").Parse(adminListTemplate))
+var adminDetail = template.Must(template.New("admin-detail").Parse(adminDetailTemplate))
+
+const adminPageSize = 25
+
+// AdminListData is passed to the template listing all responses
+type AdminListData struct {
+	// Base is the path the handler is mounted at
+	Base   string
+	Fields []Field
+	// HasStatus is set if the form declares statuses, which are then shown in their own column
+	HasStatus bool
+	// HasWebhooks is set if the server keeps a log of webhook deliveries, which is then linked to
+	HasWebhooks        bool
+	Rows               []AdminRow
+	Query, Sort, Order string
+	Total, Page, Pages int
+	PrevURL, NextURL   string
+}
+
+type AdminRow struct {
+	ID                string
+	Submitted, Status string
+	Cells             []string
+}
+
+func (d AdminListData) pageURL(sort, order string, page int) string {
+	params := url.Values{}
+	if d.Query != "" {
+		params.Set("q", d.Query)
+	}
+	params.Set("sort", sort)
+	params.Set("order", order)
+	if page > 1 {
+		params.Set("page", fmt.Sprint(page))
+	}
+	return d.Base + "/admin/?" + params.Encode()
+}
+
+// SortURL links to the list sorted by key, flipping the order if the list is already sorted by key
+func (d AdminListData) SortURL(key string) string {
+	order := "asc"
+	if d.Sort == key && d.Order == "asc" {
+		order = "desc"
+	}
+	return d.pageURL(key, order, 1)
+}
+
+func (d AdminListData) SortArrow(key string) string {
+	if d.Sort != key {
+		return ""
+	}
+	if d.Order == "desc" {
+		return " ▼"
+	}
+	return " ▲"
+}
+
+// AdminDetailData is passed to the template showing, and editing, a single response
+type AdminDetailData struct {
+	Base               string
+	ID                 string
+	Submitted, Updated string
+	// OldForm is set if the response was given to a different version of the form than the one being served
+	OldForm   bool
+	Revisions []AdminRevision
+	Statuses  []string
+	Status    string
+	Fields    []AdminField
+	Other     string
+	Error     string
+	Saved     bool
+}
+
+type AdminField struct {
+	Field
+	Value string
+}
+
+type AdminRevision struct {
+	Replaced, By, Answers string
+}
+
+// compareValues orders two answers, numerically if both are numbers and alphabetically otherwise
+func compareValues(a, b interface{}) int {
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(strings.ToLower(displayValue(a)), strings.ToLower(displayValue(b)))
+}
+
+// adminValue converts a value submitted through the admin page back into the type stored for the field's element. the
+// admin page shows answers the way they are stored, so checkboxes are a comma-separated list of option values and
+// dates may also be timestamps
+func adminValue(v *FieldDecl, req *http.Request) (interface{}, error) {
+	value := strings.TrimSpace(req.PostFormValue(v.Key))
+	switch v.Kind {
+	case "checkbox":
+		return len(req.PostForm[v.Key]) > 0, nil
+	case "checkboxes":
+		options := []interface{}{}
+		for _, option := range strings.Split(value, ",") {
+			if option = strings.TrimSpace(option); option != "" {
+				options = append(options, option)
+			}
+		}
+		return options, nil
+	case "number", "range", "date":
+		if value == "" {
+			return nil, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil && v.Kind == "date" {
+			value = t.Format(DateLayout)
+		}
+		return convertAnswer(v, value)
+	}
+	return value, nil
+}
+
+// adminAnswers reads the answers submitted through the admin page, checking them the same way submitted answers are
+func (h *Handler) adminAnswers(req *http.Request) (store.Response, []FieldError) {
+	answers := make(store.Response)
+	var errs []FieldError
+	failed := make(map[string]bool)
+	for _, v := range h.Form.Syntax.Fields() {
+		value, err := adminValue(v, req)
+		if err != nil {
+			errs = append(errs, FieldError{Key: v.Key, Message: err.Error()})
+			failed[v.Key] = true
+			continue
+		}
+		answers[v.Key] = value
+	}
+	// answers that couldn't be converted are only reported once, rather than also as missing
+	for _, fieldError := range h.Form.validate(answers) {
+		if !failed[fieldError.Key] {
+			errs = append(errs, fieldError)
+		}
+	}
+	return answers, errs
+}
+
+// checkAdmin makes sure the request carries the admin credentials, and otherwise asks for them. it also refuses
+// requests changing data that were sent from other sites, as browsers attach the stored credentials to those too
+func (h *Handler) checkAdmin(res http.ResponseWriter, req *http.Request) bool {
+	if h.Form.AdminPassword == "" {
+		http.Error(res, "The admin pages are disabled: set form-admin-password in the form to enable them", http.StatusNotFound)
+		return false
+	}
+	uname, pw, ok := req.BasicAuth()
+	validUser := subtle.ConstantTimeCompare([]byte(uname), []byte(h.Form.AdminUser)) == 1
+	validPassword := subtle.ConstantTimeCompare([]byte(pw), []byte(h.Form.AdminPassword)) == 1
+	if !ok || !validUser || !validPassword {
+		throwBasicAuthHeader(res)
+		return false
+	}
+	if req.Method == "POST" {
+		if origin := req.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != req.Host {
+				http.Error(res, "Cross-site requests are not allowed", http.StatusForbidden)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (h *Handler) AdminRoute(res http.ResponseWriter, req *http.Request) {
+	if !h.checkAdmin(res, req) {
+		return
+	}
+	path := h.path(req)
+	if id := strings.TrimPrefix(path, "/admin/response/"); id != path {
+		h.adminResponse(res, req, id)
+		return
+	}
+	if path == "/admin/webhooks" {
+		h.adminDeliveries(res, req)
+		return
+	}
+	if format := strings.TrimPrefix(path, "/admin/export."); format != path {
+		h.adminExport(res, req, format)
+		return
+	}
+	if path != "/admin/" {
+		http.NotFound(res, req)
+		return
+	}
+
+	entries, err := h.Responses.List()
+	if err != nil {
+		fmt.Println("err listing responses", err)
+		http.Error(res, "Could not list the responses", http.StatusInternalServerError)
+		return
+	}
+	data := AdminListData{Base: h.Base, Fields: h.fields, HasStatus: len(h.Form.Statuses) > 0, HasWebhooks: h.Webhooks != nil, Query: strings.TrimSpace(req.FormValue("q")), Sort: req.FormValue("sort"), Order: req.FormValue("order")}
+	if data.Sort == "" {
+		data.Sort = "id"
+	}
+	if data.Order != "desc" {
+		data.Order = "asc"
+	}
+
+	// keep the responses where any answer contains the filter
+	if data.Query != "" {
+		query := strings.ToLower(data.Query)
+		var filtered []store.Entry
+		for _, entry := range entries {
+			matches := strings.Contains(strings.ToLower(entry.ID), query) || strings.Contains(strings.ToLower(h.currentStatus(entry.Response)), query)
+			for _, field := range h.fields {
+				matches = matches || strings.Contains(strings.ToLower(displayValue(entry.Response[field.Key])), query)
+			}
+			if matches {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		var c int
+		if data.Sort == "id" {
+			c = strings.Compare(entries[i].ID, entries[j].ID)
+		} else if data.Sort == "status" {
+			c = h.statusIndex(h.currentStatus(entries[i].Response)) - h.statusIndex(h.currentStatus(entries[j].Response))
+		} else if data.Sort == "submitted" {
+			a, b := entries[i].Response.Meta().Created, entries[j].Response.Meta().Created
+			if a.Before(b) {
+				c = -1
+			} else if a.After(b) {
+				c = 1
+			}
+		} else {
+			c = compareValues(entries[i].Response[data.Sort], entries[j].Response[data.Sort])
+		}
+		if data.Order == "desc" {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	data.Total = len(entries)
+	data.Pages = (len(entries) + adminPageSize - 1) / adminPageSize
+	if data.Pages == 0 {
+		data.Pages = 1
+	}
+	data.Page, _ = strconv.Atoi(req.FormValue("page"))
+	if data.Page < 1 {
+		data.Page = 1
+	} else if data.Page > data.Pages {
+		data.Page = data.Pages
+	}
+	if data.Page > 1 {
+		data.PrevURL = data.pageURL(data.Sort, data.Order, data.Page-1)
+	}
+	if data.Page < data.Pages {
+		data.NextURL = data.pageURL(data.Sort, data.Order, data.Page+1)
+	}
+	start := (data.Page - 1) * adminPageSize
+	end := start + adminPageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	for _, entry := range entries[start:end] {
+		row := AdminRow{ID: entry.ID, Submitted: formatTime(entry.Response.Meta().Created), Status: h.currentStatus(entry.Response)}
+		for _, field := range h.fields {
+			row.Cells = append(row.Cells, displayValue(entry.Response[field.Key]))
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	err = adminList.Execute(res, data)
+	if err != nil && !errors.Is(err, syscall.EPIPE) {
+		fmt.Println("err rendering admin list", err)
+	}
+}
+
+// adminExport downloads all responses as csv, jsonl or xlsx
+func (h *Handler) adminExport(res http.ResponseWriter, req *http.Request, format string) {
+	contentType, ok := export.ContentTypes[format]
+	if !ok {
+		http.NotFound(res, req)
+		return
+	}
+	entries, err := h.Responses.List()
+	if err != nil {
+		fmt.Println("err listing responses", err)
+		http.Error(res, "Could not list the responses", http.StatusInternalServerError)
+		return
+	}
+	var fields []export.Column
+	for _, field := range h.fields {
+		fields = append(fields, export.Column{Key: field.Key, Label: field.Label})
+	}
+	// write to a buffer first, so that a failed export gets an error response rather than a truncated file
+	var buf bytes.Buffer
+	err = export.Write(&buf, format, export.Columns(fields), entries)
+	if err != nil {
+		fmt.Println("err exporting responses", err)
+		http.Error(res, "Could not export the responses", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", contentType)
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="responses.%s"`, format))
+	res.Write(buf.Bytes())
+}
+
+// adminResponse shows a single response, and handles the changes and deletions made from that page
+func (h *Handler) adminResponse(res http.ResponseWriter, req *http.Request, id string) {
+	data := AdminDetailData{Base: h.Base, ID: id}
+	// the answers submitted with a save that didn't pass validation
+	var posted url.Values
+	if req.Method == "POST" {
+		switch req.PostFormValue("action") {
+		case "delete":
+			err := h.Responses.Delete(id)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				fmt.Println("err deleting response", err)
+				http.Error(res, "Could not delete the response", http.StatusInternalServerError)
+				return
+			}
+			if err == nil {
+				h.notify(EventDeleted, id, nil)
+			}
+			http.Redirect(res, req, h.url("/admin/"), http.StatusSeeOther)
+			return
+		case "status":
+			status := req.PostFormValue("status")
+			if h.statusIndex(status) < 0 {
+				data.Error = fmt.Sprintf("unknown status %q", status)
+				break
+			}
+			var changed store.Response
+			err := h.Responses.Update(id, func(response store.Response) error {
+				meta := response.Meta()
+				meta.Status = append(h.statusHistory(meta), store.StatusChange{Status: status, Message: strings.TrimSpace(req.PostFormValue("message")), Time: time.Now().UTC()})
+				response.SetMeta(meta)
+				changed = response
+				return nil
+			})
+			if errors.Is(err, store.ErrNotFound) {
+				http.NotFound(res, req)
+				return
+			} else if err != nil {
+				data.Error = err.Error()
+			} else {
+				data.Saved = true
+				h.notify(EventUpdated, id, changed)
+			}
+		case "save":
+			answers, fieldErrors := h.adminAnswers(req)
+			if len(fieldErrors) > 0 {
+				var problems []string
+				for _, fieldError := range fieldErrors {
+					problems = append(problems, fieldError.Message)
+				}
+				data.Error = "Not saved: " + strings.Join(problems, ", ")
+				// the changes are shown again as they were made, so that they can be corrected
+				posted = req.PostForm
+				break
+			}
+			var changed store.Response
+			err := h.Responses.Update(id, func(response store.Response) error {
+				response.Revise(time.Now().UTC(), "admin", h.Form.Hash, h.KeepRevisions)
+				for _, field := range h.fields {
+					response[field.Key] = answers[field.Key]
+				}
+				changed = response
+				return nil
+			})
+			if errors.Is(err, store.ErrNotFound) {
+				http.NotFound(res, req)
+				return
+			} else if err != nil {
+				data.Error = err.Error()
+			} else {
+				data.Saved = true
+				h.notify(EventUpdated, id, changed)
+			}
+		}
+	}
+
+	response, err := h.Responses.Get(id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(res, req)
+		return
+	} else if err != nil {
+		fmt.Println("err reading response", err)
+		http.Error(res, "Could not read the response", http.StatusInternalServerError)
+		return
+	}
+	meta := response.Meta()
+	data.Submitted = formatTime(meta.Created)
+	if meta.Updated != nil {
+		data.Updated = formatTime(*meta.Updated)
+	}
+	data.OldForm = meta.FormHash != "" && meta.FormHash != h.Form.Hash
+	data.Statuses = h.Form.Statuses
+	data.Status = h.currentStatus(response)
+	// newest first
+	for i := len(meta.Revisions) - 1; i >= 0; i-- {
+		revision := meta.Revisions[i]
+		answers, _ := json.MarshalIndent(revision.Answers, "", "  ")
+		data.Revisions = append(data.Revisions, AdminRevision{Replaced: formatTime(revision.Replaced), By: revision.By, Answers: string(answers)})
+	}
+	response = response.Answers()
+	for _, field := range h.fields {
+		value := displayValue(response[field.Key])
+		if posted != nil {
+			value = posted.Get(field.Key)
+			if field.Element == "checkbox" {
+				value = strconv.FormatBool(len(posted[field.Key]) > 0)
+			}
+		}
+		data.Fields = append(data.Fields, AdminField{Field: field, Value: value})
+		delete(response, field.Key)
+	}
+	// anything stored that isn't one of the form's fields, e.g. fields that have since been removed from the form
+	if len(response) > 0 {
+		other, _ := json.MarshalIndent(response, "", "  ")
+		data.Other = string(other)
+	}
+	err = adminDetail.Execute(res, data)
+	if err != nil && !errors.Is(err, syscall.EPIPE) {
+		fmt.Println("err rendering admin view", err)
+	}
+}
@@ -0,0 +1,258 @@
+package mould
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"mould/store"
+)
+
+// FieldError describes an answer that did not pass validation
+type FieldError struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// ParseAnswers reads posted values into the answers that are stored, checking them the same way the generated
+// ParsePost and Validate do. answers are stored in the shapes their json would have on the generated FormAnswer:
+// numbers, booleans for checkboxes, lists for checkboxes, dates as timestamps and null for numbers and dates left empty
+func (f *Form) ParseAnswers(values url.Values) (store.Response, []FieldError) {
+	answers := make(store.Response)
+	// like ParsePost and Validate, answers that can't be converted are reported before the validation errors
+	var conversionErrs []FieldError
+	for _, v := range f.Syntax.Fields() {
+		value := values.Get(v.Key)
+		switch v.Kind {
+		case "number", "range", "date":
+			answers[v.Key] = nil
+			if value == "" {
+				break
+			}
+			converted, err := convertAnswer(v, value)
+			if err != nil {
+				conversionErrs = append(conversionErrs, FieldError{Key: v.Key, Message: err.Error()})
+				break
+			}
+			answers[v.Key] = converted
+		case "checkbox":
+			// unchecked checkboxes are not sent at all, so a checkbox is checked if its key is present
+			answers[v.Key] = len(values[v.Key]) > 0
+		case "checkboxes":
+			// an empty list rather than nil, so that a group with nothing checked is persisted as [] rather than null
+			options := []interface{}{}
+			for _, option := range values[v.Key] {
+				options = append(options, option)
+			}
+			answers[v.Key] = options
+		default:
+			answers[v.Key] = value
+		}
+	}
+	return answers, append(conversionErrs, f.validate(answers)...)
+}
+
+// DecodeAnswers reads answers posted as json, in the shape they are stored in (see ParseAnswers), checking them the
+// same way ParseAnswers does. fields that are left out are taken to be unanswered, other than hidden fields, which
+// get their declared value, and keys that aren't fields are ignored. the error is only set if r doesn't hold a json
+// object
+func (f *Form) DecodeAnswers(r io.Reader) (store.Response, []FieldError, error) {
+	var posted map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&posted); err != nil {
+		return nil, nil, err
+	}
+	if posted == nil {
+		return nil, nil, errors.New("expected a json object")
+	}
+	answers := make(store.Response)
+	var conversionErrs []FieldError
+	for _, v := range f.Syntax.Fields() {
+		converted, err := decodeAnswer(v, posted[v.Key])
+		if err != nil {
+			conversionErrs = append(conversionErrs, FieldError{Key: v.Key, Message: err.Error()})
+		}
+		answers[v.Key] = converted
+	}
+	return answers, append(conversionErrs, f.validate(answers)...), nil
+}
+
+// decodeAnswer checks that a json answer has the type that is stored for its element. if it doesn't, the empty answer
+// is returned along with the error
+func decodeAnswer(v *FieldDecl, value interface{}) (interface{}, error) {
+	switch v.Kind {
+	case "number", "range":
+		if value == nil {
+			return nil, nil
+		}
+		n, ok := value.(float64)
+		if !ok || (!v.IsFloat() && n != math.Trunc(n)) {
+			_, err := convertAnswer(v, fmt.Sprint(value))
+			if err == nil {
+				err = fmt.Errorf("%s must be a number", v.Title)
+			}
+			return nil, err
+		}
+		return n, nil
+	case "date":
+		if value == nil {
+			return nil, nil
+		}
+		s, _ := value.(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a date formatted as yyyy-mm-ddThh:mm:ssZ", v.Title)
+		}
+		return t.Format(time.RFC3339), nil
+	case "checkbox":
+		if value == nil {
+			return false, nil
+		}
+		checked, ok := value.(bool)
+		if !ok {
+			return false, fmt.Errorf("%s must be true or false", v.Title)
+		}
+		return checked, nil
+	case "checkboxes":
+		options := []interface{}{}
+		if value == nil {
+			return options, nil
+		}
+		list, ok := value.([]interface{})
+		for _, option := range list {
+			if _, isString := option.(string); !isString {
+				ok = false
+			}
+		}
+		if !ok {
+			return options, fmt.Errorf("%s must be a list of options", v.Title)
+		}
+		return list, nil
+	}
+	if value == nil {
+		// the form page posts a hidden field's declared value, so a field that is left out gets it too
+		if v.Kind == "hidden" {
+			return v.Content.(*TextContent).Text, nil
+		}
+		return "", nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be text", v.Title)
+	}
+	return text, nil
+}
+
+// validate checks converted answers against their fields: that required fields are answered, numbers and dates are
+// within their bounds, emails match their pattern and options are among the field's options
+func (f *Form) validate(answers store.Response) []FieldError {
+	var errs []FieldError
+	for _, v := range f.Syntax.Fields() {
+		answer := answers[v.Key]
+		var missing bool
+		switch a := answer.(type) {
+		case nil:
+			missing = true
+		case string:
+			missing = a == ""
+		case bool:
+			missing = !a
+		case []interface{}:
+			missing = len(a) == 0
+		}
+		if (v.Kind == "number" || v.Kind == "range" || v.Kind == "date") && answer != nil {
+			errs = append(errs, checkBounds(v, answer)...)
+		}
+		if v.Required && missing {
+			errs = append(errs, FieldError{Key: v.Key, Message: fmt.Sprintf("%s is required", v.Title)})
+		}
+		switch v.Kind {
+		case "email":
+			value, _ := answer.(string)
+			if value != "" && !v.Content.(*EmailContent).matches(value) {
+				errs = append(errs, FieldError{Key: v.Key, Message: fmt.Sprintf("%s is not a valid email address", v.Title)})
+			}
+		case "radio", "select":
+			if value, _ := answer.(string); value != "" && !isOption(v, value) {
+				errs = append(errs, FieldError{Key: v.Key, Message: fmt.Sprintf("%s is not one of the available options", v.Title)})
+			}
+		case "checkboxes":
+			options, _ := answer.([]interface{})
+			for _, option := range options {
+				if value := fmt.Sprint(option); value != "" && !isOption(v, value) {
+					errs = append(errs, FieldError{Key: v.Key, Message: fmt.Sprintf("%s is not one of the available options", v.Title)})
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// convertAnswer converts the answer to a number, range or date element into the value that is stored for it
+func convertAnswer(v *FieldDecl, value string) (interface{}, error) {
+	switch {
+	case v.Kind == "date":
+		t, err := time.Parse(DateLayout, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a date formatted as yyyy-mm-dd", v.Title)
+		}
+		return t.Format(time.RFC3339), nil
+	case v.IsFloat():
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", v.Title)
+		}
+		return n, nil
+	default:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number", v.Title)
+		}
+		return float64(n), nil
+	}
+}
+
+// checkBounds checks that a converted number, range or date answer is within its min and max options
+func checkBounds(v *FieldDecl, converted interface{}) []FieldError {
+	var errs []FieldError
+	answer, _ := converted.(float64)
+	if v.Kind == "date" {
+		t, _ := time.Parse(time.RFC3339, converted.(string))
+		answer = float64(t.Unix())
+	}
+	min, max := v.bounds()
+	if min != "" {
+		if bound, _ := optionNumber(v.Kind, min); answer < bound {
+			message := fmt.Sprintf("%s must be at least %s", v.Title, min)
+			if v.Kind == "date" {
+				message = fmt.Sprintf("%s must be on or after %s", v.Title, min)
+			}
+			errs = append(errs, FieldError{Key: v.Key, Message: message})
+		}
+	}
+	if max != "" {
+		if bound, _ := optionNumber(v.Kind, max); answer > bound {
+			message := fmt.Sprintf("%s must be at most %s", v.Title, max)
+			if v.Kind == "date" {
+				message = fmt.Sprintf("%s must be on or before %s", v.Title, max)
+			}
+			errs = append(errs, FieldError{Key: v.Key, Message: message})
+		}
+	}
+	return errs
+}
+
+// isOption reports whether value is the value of one of the options of a radio, select or checkboxes element
+func isOption(v *FieldDecl, value string) bool {
+	for _, label := range v.OptionLabels() {
+		if strings.ToLower(label) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package mould_test
+
+import (
+	"strings"
+	"testing"
+
+	"mould/mould"
+)
+
+// hidden fields that are left out of json answers get their declared value, like the form page posts it
+func TestDecodeHidden(t *testing.T) {
+	form, err := mould.Parse(strings.NewReader("!input[Name] =\nhidden[processed] = false\nhidden[source] = web\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	answers, errs, err := form.DecodeAnswers(strings.NewReader(`{"name": "alice", "source": "app"}`))
+	if err != nil || len(errs) > 0 {
+		t.Fatal(err, errs)
+	}
+	if answers["processed"] != "false" {
+		t.Errorf("processed is %q, expected its declared value %q", answers["processed"], "false")
+	}
+	if answers["source"] != "app" {
+		t.Errorf("source is %q, expected the posted %q", answers["source"], "app")
+	}
+}
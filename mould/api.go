@@ -0,0 +1,434 @@
+package mould
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mould/store"
+)
+
+// how many responses a page of the api's list has, unless asked for another limit, and at most
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+)
+
+// apiParameters are the query parameters of the api's list that aren't filters on a field's answers. ParseFormat
+// doesn't let fields use them as keys, so that every field can be filtered on
+var apiParameters = map[string]bool{"since": true, "until": true, "status": true, "cursor": true, "limit": true}
+
+// APIResponse is a response as the api returns it
+type APIResponse struct {
+	ID      string         `json:"id"`
+	Answers store.Response `json:"answers"`
+	Meta    store.Meta     `json:"meta"`
+}
+
+// APIList is a page of responses. NextCursor gets the next page when passed as the cursor, and is "" on the last page
+type APIList struct {
+	Responses  []APIResponse `json:"responses"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+// APIPatch is the body of a PATCH of a response: the answers to change, by their field's key, and the status to move
+// the response to, with an optional message like the admin pages have
+type APIPatch struct {
+	Answers map[string]interface{} `json:"answers"`
+	Status  string                 `json:"status"`
+	Message string                 `json:"message"`
+}
+
+// APIErrors is the body of every reply of the api that isn't a success
+type APIErrors struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// errInvalidPatch stops an update of a response whose patch has problems, which are reported separately
+var errInvalidPatch = errors.New("invalid patch")
+
+// ReadTokens reads api tokens from a config file: one token per line, ignoring blank lines and lines starting with #
+func ReadTokens(r io.Reader) ([]string, error) {
+	var tokens []string
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		token := strings.TrimSpace(scanner.Text())
+		if token == "" || strings.HasPrefix(token, "#") {
+			continue
+		}
+		if err := checkToken(token); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, scanner.Err()
+}
+
+// ReadTokensFile reads the api tokens in the config file at path, see ReadTokens. there are none if path is ""
+func ReadTokensFile(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tokens, err := ReadTokens(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+func writeJSON(res http.ResponseWriter, status int, v interface{}) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	if err := json.NewEncoder(res).Encode(v); err != nil {
+		fmt.Println("err writing json", err)
+	}
+}
+
+func writeAPIError(res http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(res, status, APIErrors{Errors: []FieldError{{Message: fmt.Sprintf(format, args...)}}})
+}
+
+// checkToken makes sure the request carries one of the api tokens, declared with form-api-tokens or set on the handler
+func (h *Handler) checkToken(res http.ResponseWriter, req *http.Request) bool {
+	tokens := append(append([]string{}, h.Form.APITokens...), h.APITokens...)
+	if len(tokens) == 0 {
+		writeAPIError(res, http.StatusNotFound, "The api is disabled: set form-api-tokens in the form to enable it")
+		return false
+	}
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	valid := false
+	for _, t := range tokens {
+		// compare against every token, so that how long checking takes doesn't tell which one is closest
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(t)) == 1 {
+			valid = true
+		}
+	}
+	if !ok || !strings.EqualFold(scheme, "Bearer") || !valid {
+		res.Header().Set("WWW-Authenticate", `Bearer realm="mould"`)
+		writeAPIError(res, http.StatusUnauthorized, "a valid api token must be passed as Authorization: Bearer <token>")
+		return false
+	}
+	return true
+}
+
+// APIRoute serves the api: the responses at /api/responses, and each of them at /api/responses/<id>
+func (h *Handler) APIRoute(res http.ResponseWriter, req *http.Request) {
+	if !h.checkToken(res, req) {
+		return
+	}
+	path := h.path(req)
+	if path == "/api/responses" || path == "/api/responses/" {
+		if req.Method != "GET" {
+			res.Header().Set("Allow", "GET")
+			writeAPIError(res, http.StatusMethodNotAllowed, "%s is not supported, only GET", req.Method)
+			return
+		}
+		h.apiList(res, req)
+		return
+	}
+	id := strings.TrimPrefix(path, "/api/responses/")
+	if id == path || strings.Contains(id, "/") {
+		writeAPIError(res, http.StatusNotFound, "no such endpoint")
+		return
+	}
+	switch req.Method {
+	case "GET":
+		response, err := h.Responses.Get(id)
+		if errors.Is(err, store.ErrNotFound) {
+			writeAPIError(res, http.StatusNotFound, "no response with id %q", id)
+			return
+		} else if err != nil {
+			fmt.Println("err reading response", err)
+			writeAPIError(res, http.StatusInternalServerError, "could not read the response")
+			return
+		}
+		writeJSON(res, http.StatusOK, apiResponse(id, response))
+	case "PATCH":
+		h.apiPatch(res, req, id)
+	case "DELETE":
+		err := h.Responses.Delete(id)
+		if errors.Is(err, store.ErrNotFound) {
+			writeAPIError(res, http.StatusNotFound, "no response with id %q", id)
+			return
+		} else if err != nil {
+			fmt.Println("err deleting response", err)
+			writeAPIError(res, http.StatusInternalServerError, "could not delete the response")
+			return
+		}
+		h.notify(EventDeleted, id, nil)
+		res.WriteHeader(http.StatusNoContent)
+	default:
+		res.Header().Set("Allow", "GET, PATCH, DELETE")
+		writeAPIError(res, http.StatusMethodNotAllowed, "%s is not supported, only GET, PATCH and DELETE", req.Method)
+	}
+}
+
+func apiResponse(id string, response store.Response) APIResponse {
+	return APIResponse{ID: id, Answers: response.Answers(), Meta: response.Meta()}
+}
+
+// apiList lists the responses, oldest first, filtered by the query: answers by their field's key (several values for
+// the same field match any of them), the current status, and when responses were submitted with since and until
+func (h *Handler) apiList(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	var since, until time.Time
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &since}, {"until", &until}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if t, err = time.Parse(DateLayout, value); err != nil {
+				writeAPIError(res, http.StatusBadRequest, "%s must be a time formatted as yyyy-mm-ddThh:mm:ssZ, or a date formatted as yyyy-mm-dd", bound.name)
+				return
+			}
+		}
+		*bound.t = t
+	}
+	limit := apiDefaultLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > apiMaxLimit {
+			writeAPIError(res, http.StatusBadRequest, "limit must be a number from 1 to %d", apiMaxLimit)
+			return
+		}
+		limit = n
+	}
+	var afterTime time.Time
+	var afterID string
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		if afterTime, afterID, err = decodeCursor(cursor); err != nil {
+			writeAPIError(res, http.StatusBadRequest, "cursor is not one returned as next_cursor")
+			return
+		}
+	}
+	filters := make(map[string][]string)
+	for key, values := range query {
+		if apiParameters[key] {
+			continue
+		}
+		if !h.isField(key) {
+			writeAPIError(res, http.StatusBadRequest, "%q is not a field of the form, nor one of since, until, status, cursor and limit", key)
+			return
+		}
+		filters[key] = values
+	}
+
+	entries, err := h.Responses.List()
+	if err != nil {
+		fmt.Println("err listing responses", err)
+		writeAPIError(res, http.StatusInternalServerError, "could not list the responses")
+		return
+	}
+	var matching []store.Entry
+	for _, entry := range entries {
+		created := entry.Response.Meta().Created
+		if (!since.IsZero() && created.Before(since)) || (!until.IsZero() && !created.Before(until)) {
+			continue
+		}
+		if status := query.Get("status"); status != "" && !strings.EqualFold(h.currentStatus(entry.Response), status) {
+			continue
+		}
+		if afterID != "" && !(created.After(afterTime) || (created.Equal(afterTime) && entry.ID > afterID)) {
+			continue
+		}
+		matches := true
+		for key, values := range filters {
+			matched := false
+			for _, value := range values {
+				matched = matched || answerMatches(entry.Response[key], value)
+			}
+			matches = matches && matched
+		}
+		if matches {
+			matching = append(matching, entry)
+		}
+	}
+	// the cursor points at the last response of a page, so responses must be listed in an order that doesn't change
+	// as new ones come in
+	sort.SliceStable(matching, func(i, j int) bool {
+		a, b := matching[i].Response.Meta().Created, matching[j].Response.Meta().Created
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return matching[i].ID < matching[j].ID
+	})
+	list := APIList{Responses: []APIResponse{}}
+	if len(matching) > limit {
+		last := matching[limit-1]
+		list.NextCursor = encodeCursor(last.Response.Meta().Created, last.ID)
+		matching = matching[:limit]
+	}
+	for _, entry := range matching {
+		list.Responses = append(list.Responses, apiResponse(entry.ID, entry.Response))
+	}
+	writeJSON(res, http.StatusOK, list)
+}
+
+// apiPatch changes some of a response's answers, keeping the earlier ones as a revision, and/or moves it to a status
+func (h *Handler) apiPatch(res http.ResponseWriter, req *http.Request, id string) {
+	var patch APIPatch
+	if err := json.NewDecoder(req.Body).Decode(&patch); err != nil {
+		writeAPIError(res, http.StatusBadRequest, "could not read the patch: %s", err)
+		return
+	}
+	if patch.Status != "" && h.statusIndex(patch.Status) < 0 {
+		writeJSON(res, http.StatusUnprocessableEntity, APIErrors{Errors: []FieldError{{Key: "status", Message: fmt.Sprintf("unknown status %q", patch.Status)}}})
+		return
+	}
+	// go through the answers in the order of the form's fields, so that problems are always reported in that order,
+	// with any keys that aren't fields last
+	var keys, unknown []string
+	for _, v := range h.Form.Syntax.Fields() {
+		if _, ok := patch.Answers[v.Key]; ok {
+			keys = append(keys, v.Key)
+		}
+	}
+	for key := range patch.Answers {
+		if !h.isField(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	keys = append(keys, unknown...)
+	var fieldErrors []FieldError
+	var patched store.Response
+	err := h.Responses.Update(id, func(response store.Response) error {
+		now := time.Now().UTC()
+		if len(patch.Answers) > 0 {
+			answers := response.Answers()
+			for _, key := range keys {
+				v, ok := h.element(key)
+				if !ok {
+					fieldErrors = append(fieldErrors, FieldError{Key: key, Message: fmt.Sprintf("%q is not a field of the form", key)})
+					continue
+				}
+				converted, err := decodeAnswer(v, patch.Answers[key])
+				if err != nil {
+					fieldErrors = append(fieldErrors, FieldError{Key: key, Message: err.Error()})
+					continue
+				}
+				answers[key] = converted
+			}
+			// answers that couldn't be read are left as they were, and aren't checked any further
+			failed := make(map[string]bool)
+			for _, fieldError := range fieldErrors {
+				failed[fieldError.Key] = true
+			}
+			// only the answers being changed are checked, so that responses given to an earlier version of the
+			// form can still be changed
+			for _, fieldError := range h.Form.validate(answers) {
+				if _, ok := patch.Answers[fieldError.Key]; ok && !failed[fieldError.Key] {
+					fieldErrors = append(fieldErrors, fieldError)
+				}
+			}
+			if len(fieldErrors) > 0 {
+				return errInvalidPatch
+			}
+			response.Revise(now, "api", h.Form.Hash, h.KeepRevisions)
+			for _, key := range keys {
+				response[key] = answers[key]
+			}
+		}
+		if patch.Status != "" {
+			meta := response.Meta()
+			meta.Status = append(h.statusHistory(meta), store.StatusChange{Status: patch.Status, Message: strings.TrimSpace(patch.Message), Time: now})
+			response.SetMeta(meta)
+		}
+		patched = response
+		return nil
+	})
+	if errors.Is(err, errInvalidPatch) {
+		writeJSON(res, http.StatusUnprocessableEntity, APIErrors{Errors: fieldErrors})
+		return
+	} else if errors.Is(err, store.ErrNotFound) {
+		writeAPIError(res, http.StatusNotFound, "no response with id %q", id)
+		return
+	} else if err != nil {
+		fmt.Println("err persisting patched response", err)
+		writeAPIError(res, http.StatusInternalServerError, "could not change the response")
+		return
+	}
+	h.notify(EventUpdated, id, patched)
+	writeJSON(res, http.StatusOK, apiResponse(id, patched))
+}
+
+// element returns the form's field with the given key
+func (h *Handler) element(key string) (*FieldDecl, bool) {
+	for _, v := range h.Form.Syntax.Fields() {
+		if v.Key == key {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (h *Handler) isField(key string) bool {
+	_, ok := h.element(key)
+	return ok
+}
+
+// answerMatches reports whether an answer is the value given for it in a query string. lists match if any of their
+// options does, and dates match the day they name
+func answerMatches(answer interface{}, value string) bool {
+	switch a := answer.(type) {
+	case nil:
+		return value == ""
+	case string:
+		if t, err := time.Parse(time.RFC3339, a); err == nil && t.Format(DateLayout) == value {
+			return true
+		}
+		return strings.EqualFold(a, value)
+	case bool:
+		return strconv.FormatBool(a) == value
+	case float64:
+		n, err := strconv.ParseFloat(value, 64)
+		return err == nil && n == a
+	case []interface{}:
+		for _, option := range a {
+			if answerMatches(option, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(answer) == value
+}
+
+// a cursor is the submission time and id of the last response of a page, which the next page starts after
+func encodeCursor(created time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(created.Format(time.RFC3339Nano) + " " + id))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	created, id, ok := strings.Cut(string(b), " ")
+	if !ok || id == "" {
+		return time.Time{}, "", errors.New("malformed cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, created)
+	return t, id, err
+}
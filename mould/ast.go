@@ -0,0 +1,266 @@
+package mould
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// File is the syntax tree of a form format file: its declarations in the order they were written, each with the
+// comments written above it. it is what parsing a form produces, and what the form is rendered, generated and
+// served from
+type File struct {
+	Decls []Decl
+	// Trailing holds the comments after the last declaration
+	Trailing []string
+}
+
+// Fields returns the file's field declarations, in the order they were written
+func (f *File) Fields() []*FieldDecl {
+	var fields []*FieldDecl
+	for _, decl := range f.Decls {
+		if field, ok := decl.(*FieldDecl); ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Decl is a declaration in a form format file: a *SettingDecl or a *FieldDecl
+type Decl interface {
+	// Pos is where the declaration was written, and what was written above it
+	Pos() Node
+	// left is everything to the left of the "=", and content everything to the right
+	left() string
+	content() string
+}
+
+// Node is what every declaration has: where it was written in its file
+type Node struct {
+	Line int
+	// Leading holds the comments and blank lines directly above the declaration, with "" for a blank line
+	Leading []string
+}
+
+func (n Node) Pos() Node {
+	return n
+}
+
+// SettingDecl configures or describes the form as a whole, e.g. `form-title = Stickers`
+type SettingDecl struct {
+	Node
+	// Kind is the setting: form-title, form-bg, form-paragraph, ...
+	Kind  string
+	Value string
+}
+
+// FieldDecl declares a field of the form, e.g. `!number[Sticker sheets]#amount = min=1, max=5`
+type FieldDecl struct {
+	Node
+	// Kind is the element of the field: input, radio, date, ...
+	Kind     string
+	Title    string
+	Required bool
+	// Key is what the answers to the field are stored under: the #key it was declared with (HasKey), or else its
+	// title in lower case. Name is the field's name on the generated FormAnswer
+	Key, Name string
+	HasKey    bool
+	Content   FieldContent
+}
+
+// FieldContent is the content of a field, as it is understood for the field's element:
+//
+//	input, textarea, hidden  *TextContent, the placeholder (or value for hidden)
+//	email                    *EmailContent
+//	number, range            *NumberContent
+//	date                     *DateContent
+//	radio, checkboxes        *ChoiceContent
+//	select                   *SelectContent
+//	checkbox                 *CheckboxContent
+type FieldContent interface {
+	// String formats the content the way it is written in a form format file
+	String() string
+}
+
+type TextContent struct {
+	Text string
+}
+
+func (c *TextContent) String() string {
+	return c.Text
+}
+
+// EmailContent holds the pattern the answers to an email field must match, or "" if any email address will do
+type EmailContent struct {
+	Pattern string
+	// the pattern compiled, anchored at both ends
+	pattern *regexp.Regexp
+}
+
+func (c *EmailContent) String() string {
+	return c.Pattern
+}
+
+// matches reports whether an answer matches the pattern, if there is one
+func (c *EmailContent) matches(answer string) bool {
+	return c.pattern == nil || c.pattern.MatchString(answer)
+}
+
+// NumberContent holds the options of a number or range field, each "" if it isn't set
+type NumberContent struct {
+	Min, Max, Step, Value string
+}
+
+func (c *NumberContent) String() string {
+	return formatOptions(numberOptions, map[string]string{"min": c.Min, "max": c.Max, "step": c.Step, "value": c.Value})
+}
+
+// DateContent holds the options of a date field as yyyy-mm-dd, each "" if it isn't set
+type DateContent struct {
+	Min, Max, Value string
+}
+
+func (c *DateContent) String() string {
+	return formatOptions(dateOptions, map[string]string{"min": c.Min, "max": c.Max, "value": c.Value})
+}
+
+// ChoiceContent holds the options of a radio or checkboxes field
+type ChoiceContent struct {
+	Options []string
+}
+
+func (c *ChoiceContent) String() string {
+	return strings.Join(c.Options, ", ")
+}
+
+// SelectContent holds the options of a select field, in groups, and the option that is selected to begin with
+type SelectContent struct {
+	Groups  []OptionGroup
+	Default string
+}
+
+// OptionGroup is a group of options of a select field. options that aren't grouped are in a group without a Label
+type OptionGroup struct {
+	Label   string
+	Options []string
+}
+
+func (c *SelectContent) String() string {
+	var groups []string
+	for i, group := range c.Groups {
+		options := strings.Join(group.Options, ", ")
+		// the default is written at the end of the last group, so that it isn't mistaken for part of a group's label
+		if i == len(c.Groups)-1 && c.Default != "" {
+			options += ", default=" + c.Default
+		}
+		if group.Label != "" {
+			options = group.Label + ": " + options
+		}
+		groups = append(groups, options)
+	}
+	return strings.Join(groups, " | ")
+}
+
+// CheckboxContent holds the text next to a checkbox, or "" if its title is shown there
+type CheckboxContent struct {
+	Label string
+}
+
+func (c *CheckboxContent) String() string {
+	return c.Label
+}
+
+func (d *SettingDecl) left() string {
+	return d.Kind
+}
+
+func (d *SettingDecl) content() string {
+	if d.Kind == "form-status" {
+		statuses, _ := parseStatuses(d.Value)
+		return strings.Join(statuses, ", ")
+	}
+	if d.Kind == "form-api-tokens" {
+		tokens, _ := parseTokens(d.Value)
+		return strings.Join(tokens, ", ")
+	}
+	if d.Kind == "form-notify" {
+		addresses, _ := parseAddresses(d.Value)
+		return strings.Join(addresses, ", ")
+	}
+	return d.Value
+}
+
+func (d *FieldDecl) left() string {
+	left := d.Kind + "[" + d.Title + "]"
+	if d.Required {
+		left = "!" + left
+	}
+	if d.HasKey {
+		left += "#" + d.Key
+	}
+	return left
+}
+
+func (d *FieldDecl) content() string {
+	return d.Content.String()
+}
+
+func formatOptions(names []string, values map[string]string) string {
+	var options []string
+	for _, name := range names {
+		if values[name] != "" {
+			options = append(options, name+"="+values[name])
+		}
+	}
+	return strings.Join(options, ", ")
+}
+
+// OptionLabels returns the options of a radio, select or checkboxes field as they are shown in the form. the value an
+// option is answered with is its label in lower case
+func (d *FieldDecl) OptionLabels() []string {
+	var labels []string
+	switch content := d.Content.(type) {
+	case *ChoiceContent:
+		labels = append(labels, content.Options...)
+	case *SelectContent:
+		for _, group := range content.Groups {
+			labels = append(labels, group.Options...)
+		}
+	}
+	return labels
+}
+
+// Pattern returns the regex an email field's answers must match, anchored at both ends like html does, or "" if any
+// email address will do
+func (d *FieldDecl) Pattern() string {
+	if content, ok := d.Content.(*EmailContent); ok && content.Pattern != "" {
+		return anchoredPattern(content.Pattern)
+	}
+	return ""
+}
+
+// IsFloat reports whether a number or range field needs a float64 rather than an int to hold its answers, which is the
+// case as soon as any of its options (most likely step) is not a whole number
+func (d *FieldDecl) IsFloat() bool {
+	content, ok := d.Content.(*NumberContent)
+	if !ok {
+		return false
+	}
+	for _, val := range []string{content.Min, content.Max, content.Step, content.Value} {
+		if _, err := strconv.Atoi(val); val != "" && err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// bounds returns the min and max options of a number, range or date field, each "" if it isn't set
+func (d *FieldDecl) bounds() (min, max string) {
+	switch content := d.Content.(type) {
+	case *NumberContent:
+		return content.Min, content.Max
+	case *DateContent:
+		return content.Min, content.Max
+	}
+	return "", ""
+}
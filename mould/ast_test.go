@@ -0,0 +1,42 @@
+package mould_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"mould/mould"
+)
+
+// the parser's syntax tree holds each field's content the way its element understands it
+func TestFieldContent(t *testing.T) {
+	f, err := os.Open("testdata/fields.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	form, err := mould.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]mould.FieldContent{
+		"name":      &mould.TextContent{Text: "your name"},
+		"amount":    &mould.NumberContent{Min: "1", Max: "5", Value: "1"},
+		"mood":      &mould.NumberContent{Min: "0", Max: "10", Step: "0.5"},
+		"pickup":    &mould.DateContent{Min: "2024-01-01", Max: "2024-12-31"},
+		"size":      &mould.ChoiceContent{Options: []string{"Small", "Medium", "Large"}},
+		"terms":     &mould.CheckboxContent{Label: "I agree"},
+		"colour":    &mould.SelectContent{Groups: []mould.OptionGroup{{Options: []string{"Red", "Blue"}}}},
+		"country":   &mould.SelectContent{Groups: []mould.OptionGroup{{Label: "Nordics", Options: []string{"Sweden", "Norway"}}, {Label: "Other", Options: []string{"France"}}}, Default: "Norway"},
+		"processed": &mould.TextContent{Text: "false"},
+	}
+	for _, field := range form.Syntax.Fields() {
+		if content, ok := want[field.Key]; ok && !reflect.DeepEqual(field.Content, content) {
+			t.Errorf("%s has content %#v, expected %#v", field.Key, field.Content, content)
+		}
+		delete(want, field.Key)
+	}
+	for key := range want {
+		t.Errorf("the form has no field %s", key)
+	}
+}
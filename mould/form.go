@@ -0,0 +1,180 @@
+// Package mould reads mould's form format, and renders and serves the forms it describes. The same package is used
+// both by the generator, which turns a form into Go code and html templates for a dedicated server, and by the server
+// mode that reads its forms at runtime.
+package mould
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Form is a parsed form format file
+type Form struct {
+	// Syntax is the syntax tree the form was parsed into: its settings and fields, in the order they were declared
+	Syntax *File
+	Title  string
+	// User and Password protect the form with basic auth, if Password is set
+	User, Password string
+	// AdminUser and AdminPassword protect the admin pages, which are disabled unless AdminPassword is set
+	AdminUser, AdminPassword string
+	// Editable is set if respondents can change their response, up to and including the day EditableUntil
+	// (yyyy-mm-dd) if set
+	Editable      bool
+	EditableUntil string
+	// Statuses are the statuses the admins can move responses through, see form-status
+	Statuses []string
+	// APITokens are the bearer tokens that give access to the responses through the api, see form-api-tokens
+	APITokens []string
+	// Webhooks are the urls that payloads about new, changed and deleted responses are posted to, signed with
+	// WebhookSecret, see form-webhook
+	Webhooks      []string
+	WebhookSecret string
+	// Notify are the email addresses that are mailed every new response, see form-notify, and Confirm is the key of the
+	// email field whose address is mailed a confirmation with a link to the response, see form-confirm
+	Notify  []string
+	Confirm string
+	Theme   Theme
+	// Source is the form format the form was parsed from, and Hash identifies that version of it
+	Source string
+	Hash   string
+}
+
+// Theme holds the colours set with form-bg, form-titlecolor and form-fg
+type Theme struct {
+	Background, Title, Foreground string
+}
+
+// Field describes one of the form's fields, the same way the generated Fields do
+type Field struct {
+	Key     string
+	Label   string
+	Element string
+	// the text each option of a radio, select or checkboxes field is shown with, by its value
+	Options map[string]string
+}
+
+// Diagnostics are the problems found in a form format. they are returned as the error of Parse
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	var problems []string
+	for _, diagnostic := range d {
+		problems = append(problems, diagnostic.String())
+	}
+	return strings.Join(problems, "\n")
+}
+
+// Parse reads and parses a form format. If the format has any problems, the error is the Diagnostics describing them
+func Parse(r io.Reader) (*Form, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// diagnostics point at the file being read, if it has a name
+	filename := "form"
+	if named, ok := r.(interface{ Name() string }); ok {
+		filename = named.Name()
+	}
+	form, diagnostics := ParseFormat(filename, string(b))
+	if len(diagnostics) > 0 {
+		return nil, Diagnostics(diagnostics)
+	}
+	return form, nil
+}
+
+// ParseFormat parses the form format in format, which was read from filename. If the format has any problems, the
+// form is nil and every problem is returned as a diagnostic
+func ParseFormat(filename, format string) (*Form, []Diagnostic) {
+	file, diagnostics := parseFile(filename, format)
+	if len(diagnostics) > 0 {
+		return nil, diagnostics
+	}
+	form := &Form{
+		Syntax: file,
+		// default user is "mouldy". only used if password is set, and can be changed with `form-user`
+		User:      "mouldy",
+		AdminUser: "admin",
+		Source:    format,
+		Hash:      fmt.Sprintf("%x", sha256.Sum256([]byte(format))),
+	}
+	for _, decl := range file.Decls {
+		v, ok := decl.(*SettingDecl)
+		if !ok {
+			continue
+		}
+		switch v.Kind {
+		case "form-title":
+			form.Title = v.Value
+		case "form-password":
+			form.Password = v.Value
+		case "form-user":
+			form.User = v.Value
+		case "form-admin-user":
+			form.AdminUser = v.Value
+		case "form-admin-password":
+			form.AdminPassword = v.Value
+		case "form-status":
+			form.Statuses, _ = parseStatuses(v.Value)
+		case "form-editable":
+			form.Editable, form.EditableUntil, _ = parseEditable(v.Value)
+		case "form-api-tokens":
+			form.APITokens, _ = parseTokens(v.Value)
+		case "form-webhook":
+			form.Webhooks = append(form.Webhooks, v.Value)
+		case "form-webhook-secret":
+			form.WebhookSecret = v.Value
+		case "form-notify":
+			form.Notify, _ = parseAddresses(v.Value)
+		case "form-confirm":
+			form.Confirm = v.Value
+		case "form-bg":
+			form.Theme.Background = v.Value
+		case "form-titlecolor":
+			form.Theme.Title = v.Value
+		case "form-fg":
+			form.Theme.Foreground = v.Value
+		}
+	}
+	return form, nil
+}
+
+// Fields describes the form's fields, in the order they were declared
+func (f *Form) Fields() []Field {
+	var fields []Field
+	for _, v := range f.Syntax.Fields() {
+		field := Field{Key: v.Key, Label: v.Title, Element: v.Kind}
+		if labels := v.OptionLabels(); len(labels) > 0 {
+			field.Options = make(map[string]string)
+			for _, label := range labels {
+				field.Options[strings.ToLower(label)] = label
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// Defaults are the values a fresh form starts out with, e.g. preselected options
+func (f *Form) Defaults() url.Values {
+	defaults := url.Values{}
+	for _, v := range f.Syntax.Fields() {
+		switch content := v.Content.(type) {
+		case *NumberContent:
+			if content.Value != "" {
+				defaults.Set(v.Key, content.Value)
+			}
+		case *DateContent:
+			if content.Value != "" {
+				defaults.Set(v.Key, content.Value)
+			}
+		case *SelectContent:
+			if content.Default != "" {
+				defaults.Set(v.Key, strings.ToLower(content.Default))
+			}
+		}
+	}
+	return defaults
+}
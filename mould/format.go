@@ -0,0 +1,177 @@
+package mould
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// pageSettings are shown at the top of the form page in the order they're declared in, which Format keeps
+var pageSettings = map[string]bool{"form-title": true, "form-desc": true, "form-image": true}
+
+// settingOrder is the order Format writes the other form settings in, after the page settings
+var settingOrder = []string{
+	"form-bg", "form-titlecolor", "form-fg", "form-user", "form-password", "form-admin-user", "form-admin-password",
+	"form-editable", "form-status", "form-api-tokens", "form-webhook", "form-webhook-secret",
+	"form-notify", "form-confirm",
+}
+
+// Format formats a form format file canonically, see File.Format. If the file has problems, the error is the
+// Diagnostics describing them
+func Format(filename, source string) (string, error) {
+	form, diagnostics := ParseFormat(filename, source)
+	if len(diagnostics) > 0 {
+		return "", Diagnostics(diagnostics)
+	}
+	formatted := form.Syntax.Format()
+	// formatting must never change what the form is, so check that the formatted file is read back as the same form
+	again, diagnostics := ParseFormat(filename, formatted)
+	if len(diagnostics) > 0 || !sameForm(form, again) || again.Syntax.Format() != formatted {
+		return "", fmt.Errorf("%s: formatting would change the form, please report this as a bug", filename)
+	}
+	return formatted, nil
+}
+
+// Format writes the file canonically: the form's title, description and image first, then the other settings in a
+// fixed order, then the fields and paragraphs in the order they were declared. Comments stay with the declaration
+// below them, the "=" of declarations that aren't separated by a blank line are lined up, and content is written in
+// its canonical form, e.g. `min=1, max=5` for a number field
+func (f *File) Format() string {
+	var page, settings, body []Decl
+	for _, decl := range f.Decls {
+		setting, ok := decl.(*SettingDecl)
+		switch {
+		case ok && pageSettings[setting.Kind]:
+			page = append(page, decl)
+		case ok && setting.Kind != "form-paragraph":
+			settings = append(settings, decl)
+		default:
+			body = append(body, decl)
+		}
+	}
+	for _, kind := range settingOrder {
+		for _, decl := range settings {
+			if decl.(*SettingDecl).Kind == kind {
+				page = append(page, decl)
+			}
+		}
+	}
+
+	// lines holds the formatted file, with the declarations still to be lined up
+	type line struct {
+		text string
+		decl Decl
+	}
+	var lines []line
+	isBlank := func(l line) bool {
+		return l.text == "" && l.decl == nil
+	}
+	// blank adds a blank line, unless there already is one
+	blank := func() {
+		if len(lines) > 0 && !isBlank(lines[len(lines)-1]) {
+			lines = append(lines, line{})
+		}
+	}
+	for _, decl := range page {
+		// settings are reordered, so only the comments above them are kept, not the blank lines
+		for _, leading := range decl.Pos().Leading {
+			if leading != "" {
+				lines = append(lines, line{text: leading})
+			}
+		}
+		lines = append(lines, line{decl: decl})
+	}
+	blank()
+	for i, decl := range body {
+		for j, leading := range decl.Pos().Leading {
+			if leading == "" {
+				// the settings are already separated from the fields by a blank line
+				if i > 0 || j > 0 {
+					blank()
+				}
+				continue
+			}
+			lines = append(lines, line{text: leading})
+		}
+		lines = append(lines, line{decl: decl})
+	}
+	for _, trailing := range f.Trailing {
+		if trailing == "" {
+			blank()
+			continue
+		}
+		lines = append(lines, line{text: trailing})
+	}
+	for len(lines) > 0 && isBlank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		// line up the "=" of each run of lines between blank lines
+		end := start
+		width := 0
+		for ; end < len(lines) && !isBlank(lines[end]); end++ {
+			if lines[end].decl != nil && len([]rune(lines[end].decl.left())) > width {
+				width = len([]rune(lines[end].decl.left()))
+			}
+		}
+		for _, l := range lines[start:end] {
+			if l.decl == nil {
+				out.WriteString(l.text + "\n")
+				continue
+			}
+			left := l.decl.left()
+			out.WriteString(left + strings.Repeat(" ", width-len([]rune(left))) + " =")
+			content := l.decl.content()
+			if strings.Contains(content, "\n") {
+				terminator := heredocWord(content)
+				out.WriteString(" <<" + terminator + "\n" + content + "\n" + terminator)
+			} else if content != "" {
+				out.WriteString(" " + content)
+			}
+			out.WriteString("\n")
+		}
+		if end < len(lines) {
+			out.WriteString("\n")
+		}
+		start = end + 1
+	}
+	return out.String()
+}
+
+// heredocWord picks a word to close a multi-line value with that doesn't appear on a line of its own in the value
+func heredocWord(content string) string {
+	word := "END"
+	for i := 2; ; i++ {
+		taken := false
+		for _, line := range strings.Split(content, "\n") {
+			if strings.TrimSpace(line) == word {
+				taken = true
+			}
+		}
+		if !taken {
+			return word
+		}
+		word = fmt.Sprintf("END%d", i)
+	}
+}
+
+// sameForm reports whether two forms are served and stored the same way, regardless of how they were written down
+func sameForm(a, b *Form) bool {
+	aIndex, aReceipt := a.RenderHTML(Page{})
+	bIndex, bReceipt := b.RenderHTML(Page{})
+	settings := func(f *Form) []interface{} {
+		return []interface{}{f.Title, f.User, f.Password, f.AdminUser, f.AdminPassword, f.Editable, f.EditableUntil, f.Statuses, f.APITokens, f.Webhooks, f.WebhookSecret, f.Notify, f.Confirm, f.Theme}
+	}
+	names := func(f *Form) []string {
+		var names []string
+		for _, v := range f.Syntax.Fields() {
+			names = append(names, v.Name)
+		}
+		return names
+	}
+	return aIndex == bIndex && aReceipt == bReceipt && reflect.DeepEqual(settings(a), settings(b)) &&
+		reflect.DeepEqual(a.Fields(), b.Fields()) && reflect.DeepEqual(a.Defaults(), b.Defaults()) &&
+		reflect.DeepEqual(names(a), names(b))
+}
@@ -0,0 +1,54 @@
+package mould_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mould/mould"
+)
+
+var update = flag.Bool("update", false, "rewrite the .golden files in testdata with how their forms are formatted now")
+
+// every form in testdata is formatted the way its .golden file says, and the .golden file, being formatted already, is
+// formatted into itself
+func TestFormatGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "*.mould"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range sources {
+		golden := strings.TrimSuffix(source, ".mould") + ".golden"
+		t.Run(filepath.Base(source), func(t *testing.T) {
+			b, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted, err := mould.Format(source, string(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *update {
+				if err = os.WriteFile(golden, []byte(formatted), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			b, err = os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := string(b); formatted != want {
+				t.Errorf("%s is formatted as:\n%s\nexpected %s:\n%s", source, formatted, golden, want)
+			}
+			again, err := mould.Format(golden, string(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != string(b) {
+				t.Errorf("%s is not formatted into itself, but into:\n%s", golden, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package mould
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// GenerateGo writes the Go code for the form's answers to w, as a package named packageName: a FormAnswer struct with
+// a typed field per form field, its ParsePost and Validate methods, and the form's settings and Fields
+func (f *Form) GenerateGo(w io.Writer, packageName string) error {
+	file := jen.NewFile(packageName)
+	var contentBits []jen.Code
+	var answer []jen.Code
+	var resParse []jen.Code
+	var validate []jen.Code
+	var fields []jen.Code
+	// the values a fresh form starts out with, e.g. preselected options
+	defaults := jen.Dict{}
+	for key, values := range f.Defaults() {
+		defaults[jen.Lit(key)] = jen.Values(jen.Lit(values[0]))
+	}
+	for _, decl := range f.Syntax.Decls {
+		setting, ok := decl.(*SettingDecl)
+		if !ok {
+			continue
+		}
+		switch setting.Kind {
+		case "form-title":
+			contentBits = append(contentBits, jen.Id("Title").String())
+		case "form-desc":
+			contentBits = append(contentBits, jen.Id("Description").String())
+		case "form-image":
+			contentBits = append(contentBits, jen.Id("Image").String())
+		case "form-password":
+			// information used for basic auth, limiting access to the form
+			contentBits = append(contentBits, jen.Id("Password").String())
+		case "form-user":
+			// information used for basic auth, limiting access to the form
+			contentBits = append(contentBits, jen.Id("User").String())
+		}
+	}
+
+	for _, input := range f.Syntax.Fields() {
+		field := jen.Dict{
+			jen.Id("Key"):     jen.Lit(input.Key),
+			jen.Id("Label"):   jen.Lit(input.Title),
+			jen.Id("Element"): jen.Lit(input.Kind),
+		}
+		if labels := input.OptionLabels(); len(labels) > 0 {
+			options := jen.Dict{}
+			for _, label := range labels {
+				options[jen.Lit(strings.ToLower(label))] = jen.Lit(label)
+			}
+			field[jen.Id("Options")] = jen.Map(jen.String()).String().Values(options)
+		}
+		fields = append(fields, jen.Values(field))
+		key, title := input.Key, input.Name
+		switch input.Kind {
+		case "textarea", "input", "hidden":
+			answer = append(answer, jen.Id(title).String().Tag(jsonTag(key)))
+			resParse = append(resParse, jen.Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(jen.Lit(key)))
+			validate = append(validate, validateRequired(input, jen.Id("answer").Dot(title).Op("==").Lit(""))...)
+		case "email":
+			answer = append(answer, jen.Id(title).String().Tag(jsonTag(key)))
+			resParse = append(resParse, jen.Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(jen.Lit(key)))
+			validate = append(validate, validateRequired(input, jen.Id("answer").Dot(title).Op("==").Lit(""))...)
+			if pattern := input.Pattern(); pattern != "" {
+				// html anchors the pattern attribute at both ends, so do the same when validating on the server
+				patternVar := lowerFirst(title) + "Pattern"
+				file.Var().Id(patternVar).Op("=").Qual("regexp", "MustCompile").Call(jen.Lit(pattern))
+				validate = append(validate, jen.If(
+					jen.Id("answer").Dot(title).Op("!=").Lit("").Op("&&").Op("!").Id(patternVar).Dot("MatchString").Call(jen.Id("answer").Dot(title)),
+				).Block(fieldError(key, fmt.Sprintf("%s is not a valid email address", input.Title))))
+			}
+		case "number", "range", "date":
+			answer = append(answer, jen.Id(title).Add(typedField(input)).Tag(jsonTag(key)))
+			resParse = append(resParse, convertValue(input, key, title))
+			validate = append(validate, validateRequired(input, jen.Id("answer").Dot(title).Op("==").Nil())...)
+			validate = append(validate, validateBounds(input, key, title)...)
+		case "radio", "select":
+			var allowed []jen.Code
+			for _, label := range input.OptionLabels() {
+				allowed = append(allowed, jen.Lit(strings.ToLower(label)))
+			}
+			answer = append(answer, jen.Id(title).String().Tag(jsonTag(key)))
+			resParse = append(resParse, jen.Id("answer").Dot(title).Op("=").Id("req").Dot("PostFormValue").Call(jen.Lit(key)))
+			validate = append(validate, validateRequired(input, jen.Id("answer").Dot(title).Op("==").Lit(""))...)
+			validate = append(validate, validateOption(jen.Id("answer").Dot(title), allowed, key, input.Title))
+		case "checkbox":
+			answer = append(answer, jen.Id(title).Bool().Tag(jsonTag(key)))
+			// unchecked checkboxes are not sent at all, so a checkbox is checked if its key is present
+			resParse = append(resParse, jen.Id("answer").Dot(title).Op("=").Len(jen.Id("req").Dot("PostForm").Index(jen.Lit(key))).Op(">").Lit(0))
+			validate = append(validate, validateRequired(input, jen.Op("!").Id("answer").Dot(title))...)
+		case "checkboxes":
+			var allowed []jen.Code
+			for _, label := range input.OptionLabels() {
+				allowed = append(allowed, jen.Lit(strings.ToLower(label)))
+			}
+			answer = append(answer, jen.Id(title).Index().String().Tag(jsonTag(key)))
+			// copy into an empty slice so that a group with nothing checked is persisted as [] rather than null
+			resParse = append(resParse, jen.Id("answer").Dot(title).Op("=").Append(jen.Index().String().Values(), jen.Id("req").Dot("PostForm").Index(jen.Lit(key)).Op("...")))
+			validate = append(validate, validateRequired(input, jen.Len(jen.Id("answer").Dot(title)).Op("==").Lit(0))...)
+			validate = append(validate, jen.For(jen.List(jen.Id("_"), jen.Id("option")).Op(":=").Range().Id("answer").Dot(title)).Block(
+				validateOption(jen.Id("option"), allowed, key, input.Title),
+			))
+		}
+	}
+
+	// set BasicPassword const
+	file.Const().Id("BasicPassword").Op("=").Lit(f.Password)
+	file.Const().Id("BasicUser").Op("=").Lit(f.User)
+	file.Const().Id("AdminPassword").Op("=").Lit(f.AdminPassword)
+	file.Const().Id("AdminUser").Op("=").Lit(f.AdminUser)
+	file.Comment("Editable is set if respondents can change their response, up to and including the day EditableUntil (yyyy-mm-dd) if set")
+	file.Const().Id("Editable").Op("=").Lit(f.Editable)
+	file.Const().Id("EditableUntil").Op("=").Lit(f.EditableUntil)
+	// the hash of the form format lets responses remember which version of the form they were given to
+	file.Comment("FormHash identifies the version of the form format this package was generated from")
+	file.Const().Id("FormHash").Op("=").Lit(f.Hash)
+	// the server parses the form format itself, so that it is served the same way as forms read at runtime
+	file.Comment("Source is the form format this package was generated from")
+	file.Const().Id("Source").Op("=").Lit(f.Source)
+	// generate FormContent struct
+	file.Type().Id("FormContent").Struct(contentBits...)
+	// generate FormAnswer struct
+	file.Type().Id("FormAnswer").Struct(answer...)
+
+	// generate FieldError struct and FieldErrors, which ParsePost returns for answers that could not be converted
+	file.Comment("FieldError describes an answer that did not pass validation")
+	file.Type().Id("FieldError").Struct(
+		jen.Id("Key").String().Tag(jsonTag("key")),
+		jen.Id("Message").String().Tag(jsonTag("message")),
+	)
+	file.Type().Id("FieldErrors").Index().Id("FieldError")
+	file.Func().Params(jen.Id("errs").Id("FieldErrors")).Id("Error").Params().String().Block(
+		jen.Var().Id("messages").Index().String(),
+		jen.For(jen.List(jen.Id("_"), jen.Id("fieldError")).Op(":=").Range().Id("errs")).Block(
+			jen.Id("messages").Op("=").Append(jen.Id("messages"), jen.Id("fieldError").Dot("Message")),
+		),
+		jen.Return(jen.Qual("strings", "Join").Call(jen.Id("messages"), jen.Lit("; "))),
+	)
+
+	// generate FormAnswer.ParsePost()
+	parsePost := []jen.Code{
+		jen.If(jen.Err().Op(":=").Id("req").Dot("ParseForm").Call(), jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err())),
+		jen.Var().Id("errs").Id("FieldErrors"),
+	}
+	parsePost = append(parsePost, resParse...)
+	parsePost = append(parsePost,
+		jen.If(jen.Len(jen.Id("errs")).Op(">").Lit(0)).Block(jen.Return(jen.Id("errs"))),
+		jen.Return(jen.Nil()),
+	)
+	file.Func().Params(
+		jen.Id("answer").Id("*FormAnswer"),
+	).Id("ParsePost").Params(
+		jen.Id("req").Op("*").Qual("net/http", "Request"),
+	).Error().Block(parsePost...)
+
+	// generate FormAnswer.Validate()
+	file.Func().Params(
+		jen.Id("answer").Id("*FormAnswer"),
+	).Id("Validate").Params().Index().Id("FieldError").Block(
+		append(append([]jen.Code{jen.Var().Id("errs").Index().Id("FieldError")}, validate...), jen.Return(jen.Id("errs")))...,
+	)
+
+	// generate Defaults, the values the form is first rendered with
+	file.Var().Id("Defaults").Op("=").Qual("net/url", "Values").Values(defaults)
+
+	// generate Fields, describing the form's fields in the order they were declared
+	file.Comment("Field describes one of the form's fields")
+	file.Type().Id("Field").Struct(
+		jen.Id("Key").String(),
+		jen.Id("Label").String(),
+		jen.Id("Element").String(),
+		jen.Comment("the text each option of a radio, select or checkboxes field is shown with, by its value"),
+		jen.Id("Options").Map(jen.String()).String(),
+	)
+	file.Var().Id("Fields").Op("=").Index().Id("Field").Values(fields...)
+
+	// generate Statuses, the statuses declared with form-status
+	var statuses []jen.Code
+	for _, status := range f.Statuses {
+		statuses = append(statuses, jen.Lit(status))
+	}
+	if len(statuses) > 0 {
+		file.Var().Id("Statuses").Op("=").Index().String().Values(statuses...)
+	} else {
+		file.Var().Id("Statuses").Index().String()
+	}
+
+	return file.Render(w)
+}
+
+func jsonTag(value string) map[string]string {
+	return map[string]string{"json": value}
+}
+
+func fieldError(key, message string) jen.Code {
+	return jen.Id("errs").Op("=").Append(jen.Id("errs"), jen.Id("FieldError").Values(jen.Dict{
+		jen.Id("Key"):     jen.Lit(key),
+		jen.Id("Message"): jen.Lit(message),
+	}))
+}
+
+// validateRequired generates the check for a required field, where missing is true if the field was not answered
+func validateRequired(v *FieldDecl, missing *jen.Statement) []jen.Code {
+	if !v.Required {
+		return nil
+	}
+	return []jen.Code{jen.If(missing).Block(fieldError(v.Key, fmt.Sprintf("%s is required", v.Title)))}
+}
+
+// validateOption generates the check that value is one of the allowed options (or empty)
+func validateOption(value *jen.Statement, allowed []jen.Code, key, label string) jen.Code {
+	return jen.Switch(value).Block(
+		jen.Case(append([]jen.Code{jen.Lit("")}, allowed...)...),
+		jen.Default().Block(fieldError(key, fmt.Sprintf("%s is not one of the available options", label))),
+	)
+}
+
+// validateBounds generates the checks that a number, range or date answer is within its min and max options
+func validateBounds(v *FieldDecl, key, title string) []jen.Code {
+	var checks []jen.Code
+	field := jen.Id("answer").Dot(title)
+	bound := func(option string) *jen.Statement {
+		if v.Kind == "date" {
+			t, _ := time.Parse(DateLayout, option)
+			return jen.Qual("time", "Date").Call(jen.Lit(t.Year()), jen.Lit(int(t.Month())), jen.Lit(t.Day()), jen.Lit(0), jen.Lit(0), jen.Lit(0), jen.Lit(0), jen.Qual("time", "UTC"))
+		}
+		if v.IsFloat() {
+			return jen.Lit(parseNumber(option))
+		}
+		return jen.Lit(int(parseNumber(option)))
+	}
+	min, max := v.bounds()
+	if min != "" {
+		var below *jen.Statement
+		message := fmt.Sprintf("%s must be at least %s", v.Title, min)
+		if v.Kind == "date" {
+			below = field.Clone().Dot("Before").Call(bound(min))
+			message = fmt.Sprintf("%s must be on or after %s", v.Title, min)
+		} else {
+			below = jen.Op("*").Add(field.Clone()).Op("<").Add(bound(min))
+		}
+		checks = append(checks, jen.If(field.Clone().Op("!=").Nil().Op("&&").Add(below)).Block(fieldError(key, message)))
+	}
+	if max != "" {
+		var above *jen.Statement
+		message := fmt.Sprintf("%s must be at most %s", v.Title, max)
+		if v.Kind == "date" {
+			above = field.Clone().Dot("After").Call(bound(max))
+			message = fmt.Sprintf("%s must be on or before %s", v.Title, max)
+		} else {
+			above = jen.Op("*").Add(field.Clone()).Op(">").Add(bound(max))
+		}
+		checks = append(checks, jen.If(field.Clone().Op("!=").Nil().Op("&&").Add(above)).Block(fieldError(key, message)))
+	}
+	return checks
+}
+
+// convertValue generates the part of ParsePost converting the submitted value of a number, range or date element into
+// its typed field. answers that are left empty stay nil
+func convertValue(v *FieldDecl, key, title string) jen.Code {
+	var convert *jen.Statement
+	message := fmt.Sprintf("%s must be a number", v.Title)
+	switch {
+	case v.Kind == "date":
+		convert = jen.Qual("time", "Parse").Call(jen.Lit(DateLayout), jen.Id("value"))
+		message = fmt.Sprintf("%s must be a date formatted as yyyy-mm-dd", v.Title)
+	case v.IsFloat():
+		convert = jen.Qual("strconv", "ParseFloat").Call(jen.Id("value"), jen.Lit(64))
+	default:
+		convert = jen.Qual("strconv", "Atoi").Call(jen.Id("value"))
+		message = fmt.Sprintf("%s must be a whole number", v.Title)
+	}
+	return jen.If(jen.Id("value").Op(":=").Id("req").Dot("PostFormValue").Call(jen.Lit(key)), jen.Id("value").Op("!=").Lit("")).Block(
+		jen.List(jen.Id("converted"), jen.Err()).Op(":=").Add(convert),
+		jen.If(jen.Err().Op("!=").Nil()).Block(
+			fieldError(key, message),
+		).Else().Block(
+			jen.Id("answer").Dot(title).Op("=").Op("&").Id("converted"),
+		),
+	)
+}
+
+// typedField returns the type of the FormAnswer field for a number, range or date element. the fields are pointers so
+// that an answer left empty is kept apart from zero, and persisted as null
+func typedField(v *FieldDecl) *jen.Statement {
+	switch {
+	case v.Kind == "date":
+		return jen.Op("*").Qual("time", "Time")
+	case v.IsFloat():
+		return jen.Op("*").Float64()
+	default:
+		return jen.Op("*").Int()
+	}
+}
+
+// parseNumber parses a number option that has already been checked by ParseFormat
+func parseNumber(s string) float64 {
+	n, _ := strconv.ParseFloat(s, 64)
+	return n
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+	return string(unicode.ToLower(r)) + s[size:]
+}
@@ -0,0 +1,35 @@
+package mould_test
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"mould/mould"
+)
+
+// fields titled with letters beyond ascii still make valid Go, including the names derived from the field's name
+func TestGenerateNonASCII(t *testing.T) {
+	form, err := mould.Parse(strings.NewReader(`form-title = Ünicode
+email[Émail]  = .*@.*
+!input[Ärende] = what's it about
+number[Ålder] = min=0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err = form.GenerateGo(&b, "myform"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parser.ParseFile(token.NewFileSet(), "myform.go", b.Bytes(), 0); err != nil {
+		t.Fatalf("generated invalid Go: %s\n%s", err, b.String())
+	}
+	for _, name := range []string{"answer.Émail", "answer.Ärende", "answer.Ålder", "émailPattern"} {
+		if !strings.Contains(b.String(), name) {
+			t.Errorf("expected %q in the generated code:\n%s", name, b.String())
+		}
+	}
+}
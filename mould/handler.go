@@ -0,0 +1,581 @@
+package mould
+
+import (
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"mould/mailer"
+	"mould/store"
+	"mould/webhook"
+)
+
+// Handler serves a form: the form page at /, each response to the person who gave it at /responder/<id>, the admin
+// pages at /admin/ and the api at /api/. all paths are below Base, so that several forms can be served side by side
+type Handler struct {
+	Form      *Form
+	Responses store.Store
+	// KeepRevisions decides whether the earlier answers of a changed response are kept in its metadata
+	KeepRevisions bool
+	// Base is the path the handler is mounted at, e.g. /f/stickers, or "" to serve the form at the root
+	Base string
+	// Webhooks is the outbox that payloads about new, changed and deleted responses are queued in for the form's
+	// form-webhook urls. nothing is sent if it's nil
+	Webhooks *webhook.Outbox
+	// ParseAnswers reads the answers posted to the form, either form-encoded by the form page or as json (see
+	// IsJSON). it defaults to the form's own ParseAnswers and DecodeAnswers, and is replaced by the generated server to
+	// go through the typed FormAnswer
+	ParseAnswers func(req *http.Request) (store.Response, []FieldError, error)
+	// APITokens give access to the api along with the form's own form-api-tokens, e.g. tokens read from a config file
+	// with ReadTokens
+	APITokens []string
+	// Mail is the outbox that mail about new responses is queued in, for the form's form-notify addresses and
+	// form-confirm field. nothing is sent if it's nil
+	Mail *mailer.Outbox
+	// PublicURL is the scheme and host the handler is reached at, e.g. https://forms.example.org, for the links in
+	// mail. mail is sent without links if it's empty
+	PublicURL string
+
+	index, receipt *template.Template
+	fields         []Field
+}
+
+// NewHandler creates a handler serving form with the given form page and receipt templates, as rendered by
+// Form.RenderHTML, storing its responses in responses
+func NewHandler(form *Form, index, receipt string, responses store.Store) (*Handler, error) {
+	h := &Handler{Form: form, Responses: responses, KeepRevisions: true, fields: form.Fields()}
+	var err error
+	if h.index, err = template.New("index").Parse(index); err != nil {
+		return nil, fmt.Errorf("form page: %w", err)
+	}
+	if h.receipt, err = template.New("receipt").Parse(receipt); err != nil {
+		return nil, fmt.Errorf("receipt: %w", err)
+	}
+	h.ParseAnswers = func(req *http.Request) (store.Response, []FieldError, error) {
+		if IsJSON(req) {
+			return form.DecodeAnswers(req.Body)
+		}
+		if err := req.ParseForm(); err != nil {
+			return nil, nil, err
+		}
+		answers, fieldErrors := form.ParseAnswers(req.PostForm)
+		return answers, fieldErrors, nil
+	}
+	return h, nil
+}
+
+// Handler serves the form with mould's default form page and receipt, for mounting the form in another web app. its
+// responses are only kept in memory: set Responses on the handler to one of the stores before serving to keep them,
+// and Base to the path the handler is mounted at
+func (f *Form) Handler() *Handler {
+	index, receipt := f.RenderHTML(Page{})
+	h, err := NewHandler(f, index, receipt, store.NewMemory())
+	if err != nil {
+		// the default pages are generated by mould itself, so this would be a bug in mould
+		panic(err)
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	path := h.path(req)
+	switch {
+	case strings.HasPrefix(path, "/responder/"):
+		h.ResponderRoute(res, req)
+	case strings.HasPrefix(path, "/admin/"):
+		h.AdminRoute(res, req)
+	case strings.HasPrefix(path, "/api/"):
+		h.APIRoute(res, req)
+	default:
+		h.IndexRoute(res, req)
+	}
+}
+
+// path is the path of the request below Base
+func (h *Handler) path(req *http.Request) string {
+	return strings.TrimPrefix(req.URL.Path, h.Base)
+}
+
+// url is the full path of one of the handler's pages
+func (h *Handler) url(format string, args ...interface{}) string {
+	return h.Base + fmt.Sprintf(format, args...)
+}
+
+// IndexData is passed to the form page template, so that the form can be re-rendered with the values that were
+// submitted alongside any validation errors
+type IndexData struct {
+	// Action is where the form is posted to
+	Action string
+	Values url.Values
+	Errors map[string]string
+}
+
+func (d IndexData) Value(key string) string {
+	return d.Values.Get(key)
+}
+
+// Has reports whether value was one of the values submitted for key, e.g. a checked radio button
+func (d IndexData) Has(key, value string) bool {
+	for _, v := range d.Values[key] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (d IndexData) Error(key string) string {
+	return d.Errors[key]
+}
+
+func (h *Handler) renderIndex(res http.ResponseWriter, data IndexData) {
+	err := h.index.Execute(res, data)
+	if errors.Is(err, syscall.EPIPE) {
+		fmt.Println("recovering from broken pipe")
+	} else if err != nil {
+		fmt.Println("err rendering form", err)
+	}
+}
+
+// used for generating a random identifier
+const characterSet = "abcdedfghijklmnopqrstABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+const pwlength = 20
+
+func generateResponseIdentifier() string {
+	var identifier strings.Builder
+	const maxChar = int64(len(characterSet))
+
+	for i := 0; i < pwlength; i++ {
+		max := big.NewInt(maxChar)
+		bigN, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			fmt.Println("crand.Int err", err)
+		}
+		n := bigN.Int64()
+		identifier.WriteString(string(characterSet[n]))
+	}
+	return identifier.String()
+}
+
+func throwBasicAuthHeader(res http.ResponseWriter) {
+	// 1: first set the header:
+	res.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+	// 2: the emit an error
+	http.Error(res, "Unauthorized", http.StatusUnauthorized)
+}
+
+// renderInvalid shows the form again, keeping what was filled in, with the errors next to the fields they concern
+func (h *Handler) renderInvalid(res http.ResponseWriter, req *http.Request, action string, fieldErrors []FieldError) {
+	data := IndexData{Action: action, Values: req.PostForm, Errors: make(map[string]string)}
+	for _, fieldError := range fieldErrors {
+		if _, exists := data.Errors[fieldError.Key]; !exists {
+			data.Errors[fieldError.Key] = fieldError.Message
+		}
+	}
+	res.WriteHeader(http.StatusUnprocessableEntity)
+	h.renderIndex(res, data)
+}
+
+func (h *Handler) IndexRoute(res http.ResponseWriter, req *http.Request) {
+	// we have basic auth set!
+	if h.Form.Password != "" {
+		// try to extract user name and password from request
+		uname, pw, ok := req.BasicAuth()
+		if !ok {
+			throwBasicAuthHeader(res)
+			return
+		}
+		valid := (h.Form.User == uname && h.Form.Password == pw)
+		if !valid {
+			throwBasicAuthHeader(res)
+			return
+		}
+		// else: basic auth was on, and we received correct credentials: please proceed!
+	}
+	if req.Method == "POST" {
+		fmt.Println("received a POST")
+		m, ok := h.readAnswer(res, req, h.url("/"))
+		if !ok {
+			return
+		}
+		meta := store.Meta{Created: time.Now().UTC(), FormHash: h.Form.Hash}
+		// new responses start out in the first of the form's statuses
+		if len(h.Form.Statuses) > 0 {
+			meta.Status = []store.StatusChange{{Status: h.Form.Statuses[0], Time: meta.Created}}
+		}
+		m.SetMeta(meta)
+		id := generateResponseIdentifier()
+		err := h.Responses.Put(id, m)
+		// on the off chance that the identifier is already taken, try another one
+		for errors.Is(err, store.ErrExists) {
+			id = generateResponseIdentifier()
+			err = h.Responses.Put(id, m)
+		}
+		if err != nil {
+			fmt.Println("err persisting response", err)
+			if IsJSON(req) {
+				h.fail(res, req, http.StatusInternalServerError, "error processing your response, it has not been persisted")
+				return
+			}
+			fmt.Fprint(res, "error processing your response, it has not been persisted - sorry! contact admin")
+			return
+		}
+		h.notify(EventCreated, id, m)
+		h.mail(id, m)
+		if IsJSON(req) {
+			res.Header().Set("Location", h.url("/responder/%s", id))
+			writeResult(res, http.StatusCreated, SubmitResult{ID: id, ReceiptURL: h.url("/responder/%s", id)})
+			return
+		}
+		// redirect to response page
+		http.Redirect(res, req, h.url("/responder/%s", id), http.StatusFound)
+	} else if req.Method == "GET" {
+		fmt.Println("GET")
+		h.renderIndex(res, IndexData{Action: h.url("/"), Values: h.Form.Defaults()})
+	}
+}
+
+// readAnswer parses and validates a posted form into the answers that are stored. if the answers can't be stored, the
+// form is shown again with what was wrong (or an error is written) and ok is false
+func (h *Handler) readAnswer(res http.ResponseWriter, req *http.Request, action string) (store.Response, bool) {
+	m, fieldErrors, err := h.ParseAnswers(req)
+	if err != nil {
+		fmt.Println("err parsing POST", err)
+		h.fail(res, req, http.StatusBadRequest, "could not read your response")
+		return nil, false
+	}
+	if len(fieldErrors) > 0 {
+		if IsJSON(req) {
+			writeResult(res, http.StatusUnprocessableEntity, SubmitResult{Errors: fieldErrors})
+			return nil, false
+		}
+		h.renderInvalid(res, req, action, fieldErrors)
+		return nil, false
+	}
+	return m, true
+}
+
+// IsJSON reports whether answers were posted as json, rather than form-encoded by the form page
+func IsJSON(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// SubmitResult is the reply to answers posted as json. on success ID and ReceiptURL say where the response can be
+// seen, and Errors is empty. otherwise Errors says what was wrong, with an empty Key for problems that aren't about a
+// single field
+type SubmitResult struct {
+	ID         string       `json:"id"`
+	ReceiptURL string       `json:"receipt_url"`
+	Errors     []FieldError `json:"errors"`
+}
+
+func writeResult(res http.ResponseWriter, status int, result SubmitResult) {
+	// an empty list rather than null, so that clients can always check the length of errors
+	if result.Errors == nil {
+		result.Errors = []FieldError{}
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	if err := json.NewEncoder(res).Encode(result); err != nil {
+		fmt.Println("err writing json result", err)
+	}
+}
+
+// fail tells the client that its answers could not be stored, as json if they were posted as json
+func (h *Handler) fail(res http.ResponseWriter, req *http.Request, status int, message string) {
+	if IsJSON(req) {
+		writeResult(res, status, SubmitResult{Errors: []FieldError{{Message: message}}})
+		return
+	}
+	http.Error(res, message, status)
+}
+
+// editable reports whether respondents can still change their responses, see form-editable
+func (h *Handler) editable(now time.Time) bool {
+	if !h.Form.Editable {
+		return false
+	}
+	if h.Form.EditableUntil == "" {
+		return true
+	}
+	until, err := time.ParseInLocation(DateLayout, h.Form.EditableUntil, time.Local)
+	// responses can be changed up to and including the last day
+	return err == nil && now.Before(until.AddDate(0, 0, 1))
+}
+
+// formValues turns stored answers back into the values the form would have posted, for filling in the form with them
+func (h *Handler) formValues(response store.Response) url.Values {
+	values := url.Values{}
+	for _, field := range h.fields {
+		switch v := response[field.Key].(type) {
+		case string:
+			if t, err := time.Parse(time.RFC3339, v); err == nil && field.Element == "date" {
+				v = t.Format(DateLayout)
+			}
+			values.Set(field.Key, v)
+		case bool:
+			if v {
+				values.Set(field.Key, "on")
+			}
+		case float64:
+			values.Set(field.Key, strconv.FormatFloat(v, 'f', -1, 64))
+		case []interface{}:
+			for _, option := range v {
+				values.Add(field.Key, fmt.Sprint(option))
+			}
+		}
+	}
+	return values
+}
+
+// statusHistory returns the status changes of a response. responses submitted before the form declared any statuses
+// are taken to have been in the first status since they were submitted
+func (h *Handler) statusHistory(meta store.Meta) []store.StatusChange {
+	if len(meta.Status) == 0 && len(h.Form.Statuses) > 0 {
+		return []store.StatusChange{{Status: h.Form.Statuses[0], Time: meta.Created}}
+	}
+	return meta.Status
+}
+
+// statusIndex is the position of status in the form's statuses, or -1 if it isn't one of them
+func (h *Handler) statusIndex(status string) int {
+	for i, s := range h.Form.Statuses {
+		if s == status {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *Handler) currentStatus(response store.Response) string {
+	history := h.statusHistory(response.Meta())
+	if len(history) == 0 {
+		return ""
+	}
+	return history[len(history)-1].Status
+}
+
+// ReceiptData is passed to the receipt template. Answer holds the answers by the name of their field on the generated
+// FormAnswer, with dates as time.Time, while Fields has them formatted as text
+type ReceiptData struct {
+	// the answers as indented json
+	Data      string
+	Answer    map[string]interface{}
+	Fields    []ReceiptField
+	Submitted string
+	EditURL   string
+	Timeline  []TimelineEntry
+}
+
+// ReceiptField is a field of the form together with its answer, formatted for showing on the receipt
+type ReceiptField struct {
+	Field
+	Text string
+}
+
+// TimelineEntry is a status in the timeline of a response; statuses the response hasn't reached yet have no Time
+type TimelineEntry struct {
+	Status, Message, Time string
+	Current               bool
+}
+
+// timeline lists the status changes of a response, followed by the statuses after the current one that it is yet to
+// reach
+func (h *Handler) timeline(meta store.Meta) []TimelineEntry {
+	history := h.statusHistory(meta)
+	if len(history) == 0 {
+		return nil
+	}
+	var entries []TimelineEntry
+	for _, change := range history {
+		entries = append(entries, TimelineEntry{Status: change.Status, Message: change.Message, Time: formatTime(change.Time)})
+	}
+	entries[len(entries)-1].Current = true
+	if current := h.statusIndex(history[len(history)-1].Status); current >= 0 {
+		for _, status := range h.Form.Statuses[current+1:] {
+			entries = append(entries, TimelineEntry{Status: status})
+		}
+	}
+	return entries
+}
+
+// namedAnswers keys answers by the name of their field on the generated FormAnswer, turning dates back into times, so
+// that custom receipts can use e.g. {{ .Answer.Name }} whether the form is generated or read at runtime
+func (h *Handler) namedAnswers(answers store.Response) map[string]interface{} {
+	named := make(map[string]interface{})
+	for _, v := range h.Form.Syntax.Fields() {
+		named[v.Name] = answers[v.Key]
+		if s, ok := answers[v.Key].(string); ok && v.Kind == "date" {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				named[v.Name] = t
+			}
+		}
+	}
+	return named
+}
+
+// ResponderRoute shows a response to the person who gave it, and lets them change it if the form is editable
+func (h *Handler) ResponderRoute(res http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(h.path(req), "/responder/")
+	if strings.HasSuffix(id, "/edit") {
+		h.responderEdit(res, req, strings.TrimSuffix(id, "/edit"))
+		return
+	}
+	val, err := h.Responses.Get(id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		fmt.Println("err reading response", err)
+	}
+	if err != nil {
+		fmt.Fprint(res, "No such form responder id")
+		return
+	}
+	answers := val.Answers()
+	niceJSON, err := json.MarshalIndent(answers, "", "  ")
+	if err != nil {
+		fmt.Printf("err marshalling stored value for id %s\n", id)
+		fmt.Fprint(res, "Had an error when formatting your stored response for web purposes. Contact admin")
+		return
+	}
+	meta := val.Meta()
+	data := ReceiptData{Data: string(niceJSON), Answer: h.namedAnswers(answers), Submitted: formatTime(meta.Created), Timeline: h.timeline(meta)}
+	for _, field := range h.fields {
+		// hidden fields are for the people running the form, not the respondent
+		if field.Element == "hidden" {
+			continue
+		}
+		data.Fields = append(data.Fields, ReceiptField{Field: field, Text: answerText(field, answers[field.Key])})
+	}
+	if h.editable(time.Now()) {
+		data.EditURL = h.url("/responder/%s/edit", id)
+	}
+	err = h.receipt.Execute(res, data)
+	if errors.Is(err, syscall.EPIPE) {
+		fmt.Println("recovering from broken pipe")
+		return
+	} else if err != nil {
+		fmt.Println("err rendering reponder view", err)
+	}
+}
+
+// responderEdit shows the form filled in with a response's answers, and replaces the answers with the changed ones
+// when it is posted
+func (h *Handler) responderEdit(res http.ResponseWriter, req *http.Request, id string) {
+	if !h.editable(time.Now()) {
+		h.fail(res, req, http.StatusForbidden, "Responses to this form can no longer be changed")
+		return
+	}
+	action := h.url("/responder/%s/edit", id)
+	if req.Method == "POST" {
+		answers, ok := h.readAnswer(res, req, action)
+		if !ok {
+			return
+		}
+		var changed store.Response
+		err := h.Responses.Update(id, func(response store.Response) error {
+			response.Revise(time.Now().UTC(), "respondent", h.Form.Hash, h.KeepRevisions)
+			for _, field := range h.fields {
+				// hidden fields aren't the respondent's to change, e.g. a processed flag set from the admin pages
+				if field.Element == "hidden" {
+					continue
+				}
+				response[field.Key] = answers[field.Key]
+			}
+			changed = response
+			return nil
+		})
+		if errors.Is(err, store.ErrNotFound) {
+			h.fail(res, req, http.StatusNotFound, "No such form responder id")
+			return
+		} else if err != nil {
+			fmt.Println("err persisting changed response", err)
+			if IsJSON(req) {
+				h.fail(res, req, http.StatusInternalServerError, "error processing your response, your changes have not been persisted")
+				return
+			}
+			fmt.Fprint(res, "error processing your response, your changes have not been persisted - sorry! contact admin")
+			return
+		}
+		h.notify(EventUpdated, id, changed)
+		if IsJSON(req) {
+			writeResult(res, http.StatusOK, SubmitResult{ID: id, ReceiptURL: h.url("/responder/%s", id)})
+			return
+		}
+		http.Redirect(res, req, h.url("/responder/%s", id), http.StatusSeeOther)
+		return
+	}
+	response, err := h.Responses.Get(id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(res, req)
+		return
+	} else if err != nil {
+		fmt.Println("err reading response", err)
+		http.Error(res, "Could not read your response", http.StatusInternalServerError)
+		return
+	}
+	h.renderIndex(res, IndexData{Action: action, Values: h.formValues(response)})
+}
+
+// formatTime formats the times kept in a response's metadata for showing them to people
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "at an unknown time"
+	}
+	return t.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// displayValue formats an answer, as stored, for showing it in the admin pages
+func displayValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		var parts []string
+		for _, part := range v {
+			parts = append(parts, displayValue(part))
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// answerText formats an answer, as stored, for showing it to the respondent: options are shown with the text they had
+// in the form, and checkboxes as yes or no
+func answerText(field Field, v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		if label, ok := field.Options[v]; ok {
+			return label
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil && field.Element == "date" {
+			return t.Format(DateLayout)
+		}
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case []interface{}:
+		var parts []string
+		for _, part := range v {
+			parts = append(parts, answerText(field, part))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return displayValue(v)
+}
@@ -0,0 +1,200 @@
+package mould_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"mould/mould"
+	"mould/store"
+)
+
+const raceForm = `form-title = Race
+!input[Name] = your name
+`
+
+// every response posted at the same time has to end up stored, and on disk; run with -race to also catch unguarded
+// access to the responses
+func TestConcurrentPosts(t *testing.T) {
+	const posts = 50
+	for _, kind := range store.Kinds {
+		t.Run(kind, func(t *testing.T) {
+			form, err := mould.Parse(strings.NewReader(raceForm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "responses"+filepath.Ext(store.DefaultPath(kind)))
+			responses, err := store.Open(kind, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, receipt := form.RenderHTML(mould.Page{})
+			handler, err := mould.NewHandler(form, index, receipt, responses)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, posts)
+			for i := 0; i < posts; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					res, err := client.PostForm(server.URL+"/", url.Values{"name": {fmt.Sprintf("respondent %d", i)}})
+					if err != nil {
+						errs <- err
+						return
+					}
+					res.Body.Close()
+					if res.StatusCode != http.StatusFound {
+						errs <- fmt.Errorf("post %d: got status %d, expected a redirect to the receipt", i, res.StatusCode)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			entries, err := responses.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != posts {
+				t.Errorf("stored %d responses, expected %d", len(entries), posts)
+			}
+			if err = responses.Close(); err != nil {
+				t.Fatal(err)
+			}
+			reopened, err := store.Open(kind, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+			if entries, err = reopened.List(); err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != posts {
+				t.Errorf("%d responses made it to disk, expected %d", len(entries), posts)
+			}
+		})
+	}
+}
+
+const jsonForm = `form-title = Stickers
+!input[Name] = your name
+number[Amount] = min=1, max=5
+hidden[Source] = web
+checkboxes[Toppings] = Cheese, Olives
+`
+
+// answers posted as json are stored and answered with where to find them, or refused with what's wrong with each field
+func TestJSONPost(t *testing.T) {
+	for _, test := range []struct {
+		name, body string
+		status     int
+		errors     []mould.FieldError
+		stored     store.Response
+	}{
+		{
+			name:   "valid",
+			body:   `{"name": "Ada", "amount": 3, "toppings": ["cheese"]}`,
+			status: http.StatusCreated,
+			stored: store.Response{"name": "Ada", "amount": float64(3), "source": "web", "toppings": []interface{}{"cheese"}},
+		},
+		{
+			name:   "missing required field",
+			body:   `{"amount": 3}`,
+			status: http.StatusUnprocessableEntity,
+			errors: []mould.FieldError{{Key: "name", Message: "Name is required"}},
+		},
+		{
+			name:   "out of bounds",
+			body:   `{"name": "Ada", "amount": 6}`,
+			status: http.StatusUnprocessableEntity,
+			errors: []mould.FieldError{{Key: "amount", Message: "Amount must be at most 5"}},
+		},
+		{
+			name:   "several problems",
+			body:   `{"amount": 0, "toppings": ["ham"]}`,
+			status: http.StatusUnprocessableEntity,
+			errors: []mould.FieldError{
+				{Key: "name", Message: "Name is required"},
+				{Key: "amount", Message: "Amount must be at least 1"},
+				{Key: "toppings", Message: "Toppings is not one of the available options"},
+			},
+		},
+		{
+			name:   "wrong type",
+			body:   `{"name": "Ada", "amount": "three"}`,
+			status: http.StatusUnprocessableEntity,
+			errors: []mould.FieldError{{Key: "amount", Message: "Amount must be a whole number"}},
+		},
+		{
+			name:   "not an object",
+			body:   `["Ada"]`,
+			status: http.StatusBadRequest,
+			errors: []mould.FieldError{{Message: "could not read your response"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			form, err := mould.Parse(strings.NewReader(jsonForm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			responses := store.NewMemory()
+			index, receipt := form.RenderHTML(mould.Page{})
+			handler, err := mould.NewHandler(form, index, receipt, responses)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.status {
+				t.Fatalf("got status %d, expected %d: %s", rec.Code, test.status, rec.Body)
+			}
+			var result mould.SubmitResult
+			if err = json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("%s: %s", err, rec.Body)
+			}
+			if len(result.Errors) != len(test.errors) || (len(test.errors) > 0 && !reflect.DeepEqual(result.Errors, test.errors)) {
+				t.Errorf("got errors %v, expected %v", result.Errors, test.errors)
+			}
+			entries, err := responses.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.stored == nil {
+				if len(entries) > 0 || result.ID != "" {
+					t.Errorf("stored %v as %q, expected nothing to be stored", entries, result.ID)
+				}
+				return
+			}
+			if len(entries) != 1 || entries[0].ID != result.ID {
+				t.Fatalf("stored %v, expected a single response with id %q", entries, result.ID)
+			}
+			if receipt := "/responder/" + result.ID; result.ReceiptURL != receipt || rec.Header().Get("Location") != receipt {
+				t.Errorf("got receipt url %q and location %q, expected %q", result.ReceiptURL, rec.Header().Get("Location"), receipt)
+			}
+			if answers := entries[0].Response.Answers(); !reflect.DeepEqual(answers, test.stored) {
+				t.Errorf("stored %v, expected %v", answers, test.stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package mould
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// LiveHandler serves whichever handler it was last given, so that a changed form can be swapped in while the old one
+// is being served. requests that already started finish on the handler they started on
+type LiveHandler struct {
+	current atomic.Value
+}
+
+func NewLiveHandler(h http.Handler) *LiveHandler {
+	live := &LiveHandler{}
+	live.Swap(h)
+	return live
+}
+
+// Swap replaces the handler that new requests are served by
+func (l *LiveHandler) Swap(h http.Handler) {
+	// stored through a pointer, as atomic.Value wants every value stored in it to have the same type
+	l.current.Store(&h)
+}
+
+func (l *LiveHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	h := l.current.Load().(*http.Handler)
+	(*h).ServeHTTP(res, req)
+}
@@ -0,0 +1,192 @@
+package mould
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"mould/mailer"
+	"mould/store"
+)
+
+var notifyTextTemplate = `There is a new response to {{ .Title }}: {{ .ID }}, submitted {{ .Submitted }}.
+{{ range .Fields }}
+{{ .Label }}:
+{{ .Text }}
+{{ end }}{{ if .AdminURL }}
+See it in the admin pages: {{ .AdminURL }}
+{{ end }}`
+
+var notifyHTMLTemplate = `<!DOCTYPE html>
+<html>
+	<body style="font-family: sans-serif;">
+		<p>There is a new response to {{ .Title }}: {{ .ID }}, submitted {{ .Submitted }}.</p>
+		<dl>
+			{{ range .Fields }}
+			<dt style="font-weight: bold;">{{ .Label }}</dt>
+			<dd style="white-space: pre-wrap; margin: 0 0 0.75rem 0;">{{ .Text }}</dd>
+			{{ end }}
+		</dl>
+		{{ if .AdminURL }}<p><a href="{{ .AdminURL }}">See it in the admin pages</a></p>{{ end }}
+	</body>
+</html>`
+
+var confirmTextTemplate = `Thanks for your response to {{ .Title }}! These are the answers you gave:
+{{ range .Fields }}
+{{ .Label }}:
+{{ .Text }}
+{{ end }}{{ if .ReceiptURL }}
+Your response can be seen{{ if .Editable }}, and changed,{{ end }} at {{ .ReceiptURL }}
+{{ end }}`
+
+var confirmHTMLTemplate = `<!DOCTYPE html>
+<html>
+	<body style="font-family: sans-serif;">
+		<p>Thanks for your response to {{ .Title }}! These are the answers you gave:</p>
+		<dl>
+			{{ range .Fields }}
+			<dt style="font-weight: bold;">{{ .Label }}</dt>
+			<dd style="white-space: pre-wrap; margin: 0 0 0.75rem 0;">{{ .Text }}</dd>
+			{{ end }}
+		</dl>
+		{{ if .ReceiptURL }}<p><a href="{{ .ReceiptURL }}">See your response{{ if .Editable }}, or change it{{ end }}</a></p>{{ end }}
+	</body>
+</html>`
+
+var (
+	notifyText  = texttemplate.Must(texttemplate.New("notify-text").Parse(notifyTextTemplate))
+	notifyHTML  = template.Must(template.New("notify-html").Parse(notifyHTMLTemplate))
+	confirmText = texttemplate.Must(texttemplate.New("confirm-text").Parse(confirmTextTemplate))
+	confirmHTML = template.Must(template.New("confirm-html").Parse(confirmHTMLTemplate))
+)
+
+// MailData is passed to the templates of the mail about a new response
+type MailData struct {
+	// Title is the form's title, or "the form" if it has none
+	Title     string
+	ID        string
+	Submitted string
+	Fields    []ReceiptField
+	// ReceiptURL is where the respondent can see their response, and AdminURL where the response is in the admin
+	// pages, if they are enabled. both are "" without a PublicURL
+	ReceiptURL string
+	AdminURL   string
+	Editable   bool
+}
+
+// MailFlags declares the flags for the smtp server that form-notify and form-confirm mail is sent through, and for the
+// url the links in it point to. the password is read from $MOULD_SMTP_PASSWORD rather than a flag, so that it doesn't
+// show up in the list of processes
+func MailFlags(flags *flag.FlagSet, config *mailer.Config, publicURL *string) {
+	flags.StringVar(&config.Addr, "smtp", "", "the host:port of the smtp server to send form-notify and form-confirm mail through (default: no mail is sent)")
+	flags.StringVar(&config.User, "smtp-user", "", "the user to log in to the smtp server as, with the password in $MOULD_SMTP_PASSWORD")
+	flags.StringVar(&config.From, "mail-from", "", "the address mail is sent from, e.g. \"Stickers <stickers@example.org>\"")
+	flags.StringVar(publicURL, "public-url", "", "the scheme and host the server is reached at, e.g. https://forms.example.org, for the links in mail (default: mail has no links)")
+	config.Password = os.Getenv("MOULD_SMTP_PASSWORD")
+}
+
+// OpenMail opens the outbox that mail is queued in, next to the responses stored at storePath, and starts sending it.
+// the outbox is nil if no smtp server is configured
+func OpenMail(storePath string, config mailer.Config) (*mailer.Outbox, error) {
+	if config.Addr == "" {
+		return nil, nil
+	}
+	outbox, err := mailer.Open(storePath+".mail.json", config)
+	if err != nil {
+		return nil, err
+	}
+	outbox.Start()
+	return outbox, nil
+}
+
+// MailWarning points out that the form wants mail sent by a server that can't send any, or that the mail will go
+// without links for lack of a public url, or is "" if neither is the case
+func (f *Form) MailWarning(mail *mailer.Outbox, publicURL string) string {
+	switch {
+	case len(f.Notify) == 0 && f.Confirm == "":
+		return ""
+	case mail == nil:
+		return "the form sets form-notify or form-confirm, but no mail is sent without --smtp"
+	case publicURL == "":
+		return "the form sets form-notify or form-confirm, but the mail has no links to the response without --public-url"
+	}
+	return ""
+}
+
+// absoluteURL is the full url of one of the handler's pages, for links that are followed from outside of the browser
+// the form was filled in in, or "" without a PublicURL. the host a request was made to can't stand in for it: it's
+// whatever the client says it is, and would let anyone send mail from the form that links to a site of their choosing
+func (h *Handler) absoluteURL(format string, args ...interface{}) string {
+	if h.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(h.PublicURL, "/") + h.url(format, args...)
+}
+
+// mail queues the mail about a new response: a notification with the answers for the form's form-notify addresses,
+// and a confirmation with a link to the response for the respondent, if the form has form-confirm and they gave
+// their address
+func (h *Handler) mail(id string, response store.Response) {
+	if h.Mail == nil || (len(h.Form.Notify) == 0 && h.Form.Confirm == "") {
+		return
+	}
+	data := MailData{
+		Title:      h.Form.Title,
+		ID:         id,
+		Submitted:  formatTime(response.Meta().Created),
+		ReceiptURL: h.absoluteURL("/responder/%s", id),
+		Editable:   h.editable(time.Now()),
+	}
+	if data.Title == "" {
+		data.Title = "the form"
+	}
+	if h.Form.AdminPassword != "" {
+		data.AdminURL = h.absoluteURL("/admin/response/%s", id)
+	}
+	answers := response.Answers()
+	respondent, _ := answers[h.Form.Confirm].(string)
+	respondent = strings.TrimSpace(respondent)
+
+	// fields that weren't answered are left out, to keep the mail short
+	fields := func(hidden bool) []ReceiptField {
+		var fields []ReceiptField
+		for _, field := range h.fields {
+			text := answerText(field, answers[field.Key])
+			if text == "" || (field.Element == "hidden" && !hidden) {
+				continue
+			}
+			fields = append(fields, ReceiptField{Field: field, Text: text})
+		}
+		return fields
+	}
+	if len(h.Form.Notify) > 0 {
+		// the people running the form see every answer, including the hidden fields
+		data.Fields = fields(true)
+		h.queueMail(mailer.Mail{To: h.Form.Notify, ReplyTo: respondent, Subject: "New response to " + data.Title}, notifyText, notifyHTML, data)
+	}
+	if h.Form.Confirm != "" && respondent != "" {
+		data.Fields = fields(false)
+		h.queueMail(mailer.Mail{To: []string{respondent}, Subject: "Your response to " + data.Title}, confirmText, confirmHTML, data)
+	}
+}
+
+// queueMail renders the plain text and html bodies of a mail and queues it
+func (h *Handler) queueMail(m mailer.Mail, text *texttemplate.Template, html *template.Template, data MailData) {
+	var textBody, htmlBody bytes.Buffer
+	err := text.Execute(&textBody, data)
+	if err == nil {
+		err = html.Execute(&htmlBody, data)
+	}
+	if err == nil {
+		m.Text, m.HTML = textBody.String(), htmlBody.String()
+		err = h.Mail.Enqueue(m)
+	}
+	if err != nil {
+		fmt.Println("err queueing mail", err)
+	}
+}
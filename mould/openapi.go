@@ -0,0 +1,346 @@
+package mould
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OpenAPI describes the form server's endpoints as an OpenAPI 3.1 document: posting the form to /, form-encoded or as
+// json, the receipt of a response at /responder/{id}, along with changing it if the form is editable, and the api at
+// /api/responses. FormAnswer is described with the same schema as JSONSchema
+func (f *Form) OpenAPI() ([]byte, error) {
+	title := f.Title
+	if title == "" {
+		title = "mould form"
+	}
+	html := func(description string) jsonObject {
+		return jsonObject{
+			{"description", description},
+			{"content", jsonObject{{"text/html", jsonObject{{"schema", jsonObject{{"type", "string"}}}}}}},
+		}
+	}
+	// answers are posted form-encoded by the form page, or as json by scripts and other frontends
+	formBody := jsonObject{
+		{"required", true},
+		{"content", jsonObject{
+			{"application/x-www-form-urlencoded", jsonObject{{"schema", ref("FormPost")}}},
+			{"application/json", jsonObject{{"schema", ref("FormAnswer")}}},
+		}},
+	}
+	// result is the reply to answers posted as json
+	result := func(description string) jsonObject {
+		return jsonObject{
+			{"description", description},
+			{"content", jsonObject{{"application/json", jsonObject{{"schema", ref("SubmitResult")}}}}},
+		}
+	}
+	// invalid is the reply to answers that did not pass validation
+	invalid := jsonObject{
+		{"description", "the answers did not pass validation: the form is shown again, with an error next to each field that needs fixing, or the errors are listed if the answers were posted as json"},
+		{"content", jsonObject{
+			{"text/html", jsonObject{{"schema", jsonObject{{"type", "string"}}}}},
+			{"application/json", jsonObject{{"schema", ref("SubmitResult")}}},
+		}},
+	}
+	idParameter := jsonObject{
+		{"name", "id"},
+		{"in", "path"},
+		{"required", true},
+		{"description", "the id of the response, as given in the link to it"},
+		{"schema", jsonObject{{"type", "string"}}},
+	}
+	redirect := func(description, location string) jsonObject {
+		return jsonObject{
+			{"description", description},
+			{"headers", jsonObject{{"Location", jsonObject{
+				{"description", location},
+				{"schema", jsonObject{{"type", "string"}}},
+			}}}},
+		}
+	}
+
+	// only the form page is behind basic auth, the links to responses are secret enough
+	getResponses := jsonObject{{"200", html("the form")}}
+	postResponses := jsonObject{
+		{"201", result("the response posted as json was stored")},
+		{"302", redirect("the response was stored", "the receipt of the response, /responder/{id}")},
+		{"400", result("the json could not be read")},
+		{"422", invalid},
+	}
+	if f.Password != "" {
+		unauthorized := jsonObject{{"description", "the user and password were missing or wrong"}}
+		getResponses.set("401", unauthorized)
+		postResponses.set("401", unauthorized)
+	}
+	get := jsonObject{{"summary", "The form page"}, {"responses", getResponses}}
+	post := jsonObject{{"summary", "Submit a response"}, {"requestBody", formBody}, {"responses", postResponses}}
+	if f.Password != "" {
+		get.set("security", []jsonObject{{{"basicAuth", []string{}}}})
+		post.set("security", []jsonObject{{{"basicAuth", []string{}}}})
+	}
+	var paths jsonObject
+	paths.set("/", jsonObject{{"get", get}, {"post", post}})
+	paths.set("/responder/{id}", jsonObject{
+		{"parameters", []jsonObject{idParameter}},
+		{"get", jsonObject{
+			{"summary", "The receipt of a response"},
+			{"responses", jsonObject{{"200", html("the answers of the response, and its status if the form has statuses")}}},
+		}},
+	})
+	if f.Editable {
+		paths.set("/responder/{id}/edit", jsonObject{
+			{"parameters", []jsonObject{idParameter}},
+			{"get", jsonObject{
+				{"summary", "The form, filled in with a response's answers"},
+				{"responses", jsonObject{
+					{"200", html("the form")},
+					{"403", html("responses can no longer be changed")},
+				}},
+			}},
+			{"post", jsonObject{
+				{"summary", "Change a response"},
+				{"requestBody", formBody},
+				{"responses", jsonObject{
+					{"200", result("the response was changed with answers posted as json")},
+					{"303", redirect("the response was changed", "the receipt of the response")},
+					{"400", result("the json could not be read")},
+					{"403", html("responses can no longer be changed")},
+					{"404", html("there is no response with this id")},
+					{"422", invalid},
+				}},
+			}},
+		})
+	}
+
+	var answerProperties, postProperties jsonObject
+	answerRequired, postRequired := []string{}, []string{}
+	for _, v := range f.Syntax.Fields() {
+		answerProperties.set(v.Key, fieldSchema(v))
+		postProperties.set(v.Key, postSchema(v))
+		if v.Required {
+			answerRequired = append(answerRequired, v.Key)
+			postRequired = append(postRequired, v.Key)
+		}
+	}
+	schemas := jsonObject{
+		{"FormAnswer", jsonObject{
+			{"description", "the answers to the form, as they are stored and exported"},
+			{"type", "object"},
+			{"properties", answerProperties},
+			{"required", answerRequired},
+		}},
+		{"FormPost", jsonObject{
+			{"description", "the answers to the form, as they are posted by the form page"},
+			{"type", "object"},
+			{"properties", postProperties},
+			{"required", postRequired},
+		}},
+		{"SubmitResult", jsonObject{
+			{"description", "the reply to answers posted as json. errors is empty if the answers were stored"},
+			{"type", "object"},
+			{"properties", jsonObject{
+				{"id", jsonObject{{"type", "string"}}},
+				{"receipt_url", jsonObject{{"type", "string"}, {"description", "the path of the receipt of the response"}}},
+				{"errors", jsonObject{{"type", "array"}, {"items", ref("FieldError")}}},
+			}},
+			{"required", []string{"id", "receipt_url", "errors"}},
+		}},
+		{"FieldError", jsonObject{
+			{"description", "an answer that did not pass validation"},
+			{"type", "object"},
+			{"properties", jsonObject{{"key", jsonObject{{"type", "string"}}}, {"message", jsonObject{{"type", "string"}}}}},
+			{"required", []string{"key", "message"}},
+		}},
+	}
+	// the api is described even if the form declares no tokens, as they can also be passed to the server
+	f.describeAPI(&paths, &schemas)
+	securitySchemes := jsonObject{{"bearerAuth", jsonObject{{"type", "http"}, {"scheme", "bearer"}}}}
+	if f.Password != "" {
+		securitySchemes.set("basicAuth", jsonObject{{"type", "http"}, {"scheme", "basic"}})
+	}
+	components := jsonObject{{"schemas", schemas}, {"securitySchemes", securitySchemes}}
+
+	document := jsonObject{
+		{"openapi", "3.1.0"},
+		{"info", jsonObject{{"title", title}, {"version", f.Hash[:12]}}},
+		{"paths", paths},
+		{"components", components},
+	}
+	b, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func ref(schema string) jsonObject {
+	return jsonObject{{"$ref", "#/components/schemas/" + schema}}
+}
+
+// postSchema describes the value posted for a field by the form page, where everything is text
+func postSchema(v *FieldDecl) jsonObject {
+	var p jsonObject
+	p.set("title", v.Title)
+	var options []string
+	for _, label := range v.OptionLabels() {
+		options = append(options, strings.ToLower(label))
+	}
+	switch v.Kind {
+	case "checkbox":
+		// unchecked checkboxes are not sent at all
+		p.set("type", "string")
+		p.set("enum", []string{"on"})
+	case "checkboxes":
+		p.set("type", "array")
+		p.set("items", jsonObject{{"type", "string"}, {"enum", options}})
+	case "radio", "select":
+		p.set("type", "string")
+		p.set("enum", options)
+	case "date":
+		p.set("type", "string")
+		p.set("format", "date")
+	case "number", "range":
+		p.set("type", "string")
+		p.set("description", "a number")
+		min, max := v.bounds()
+		if min != "" {
+			p.set("x-minimum", json.Number(min))
+		}
+		if max != "" {
+			p.set("x-maximum", json.Number(max))
+		}
+	default:
+		p.set("type", "string")
+	}
+	return p
+}
+
+// describeAPI adds the api's endpoints and the schemas of what they take and return
+func (f *Form) describeAPI(paths, schemas *jsonObject) {
+	object := func(description string, properties jsonObject, required ...string) jsonObject {
+		o := jsonObject{{"description", description}, {"type", "object"}, {"properties", properties}}
+		if len(required) > 0 {
+			o.set("required", required)
+		}
+		return o
+	}
+	str := jsonObject{{"type", "string"}}
+	timestamp := jsonObject{{"type", "string"}, {"format", "date-time"}}
+	reply := func(description, schema string) jsonObject {
+		return jsonObject{
+			{"description", description},
+			{"content", jsonObject{{"application/json", jsonObject{{"schema", ref(schema)}}}}},
+		}
+	}
+	errorReply := func(description string) jsonObject {
+		return reply(description, "APIErrors")
+	}
+	security := []jsonObject{{{"bearerAuth", []string{}}}}
+	query := func(name, description string) jsonObject {
+		return jsonObject{{"name", name}, {"in", "query"}, {"description", description}, {"schema", str}}
+	}
+
+	parameters := []jsonObject{
+		query("since", "only responses submitted at or after this time (yyyy-mm-ddThh:mm:ssZ) or day (yyyy-mm-dd)"),
+		query("until", "only responses submitted before this time or day"),
+		query("status", "only responses currently in this status"),
+		query("cursor", "the next_cursor of the previous page"),
+		{{"name", "limit"}, {"in", "query"}, {"description", "how many responses a page has"}, {"schema", jsonObject{{"type", "integer"}, {"minimum", 1}, {"maximum", apiMaxLimit}, {"default", apiDefaultLimit}}}},
+	}
+	for _, v := range f.Syntax.Fields() {
+		if !apiParameters[v.Key] {
+			parameters = append(parameters, jsonObject{
+				{"name", v.Key},
+				{"in", "query"},
+				{"description", fmt.Sprintf("only responses whose answer to %s is this value, or any of the values if given more than once", v.Title)},
+				{"schema", jsonObject{{"type", "array"}, {"items", str}}},
+				{"explode", true},
+			})
+		}
+	}
+	paths.set("/api/responses", jsonObject{
+		{"get", jsonObject{
+			{"summary", "List the responses, oldest first"},
+			{"security", security},
+			{"parameters", parameters},
+			{"responses", jsonObject{
+				{"200", reply("a page of responses", "APIList")},
+				{"400", errorReply("a parameter is not understood")},
+				{"401", errorReply("the api token is missing or wrong")},
+			}},
+		}},
+	})
+	notFound := errorReply("there is no response with this id")
+	paths.set("/api/responses/{id}", jsonObject{
+		{"parameters", []jsonObject{{{"name", "id"}, {"in", "path"}, {"required", true}, {"schema", str}}}},
+		{"get", jsonObject{
+			{"summary", "Get a response"},
+			{"security", security},
+			{"responses", jsonObject{
+				{"200", reply("the response", "APIResponse")},
+				{"401", errorReply("the api token is missing or wrong")},
+				{"404", notFound},
+			}},
+		}},
+		{"patch", jsonObject{
+			{"summary", "Change some of a response's answers, and/or move it to a status"},
+			{"security", security},
+			{"requestBody", jsonObject{{"required", true}, {"content", jsonObject{{"application/json", jsonObject{{"schema", ref("APIPatch")}}}}}}},
+			{"responses", jsonObject{
+				{"200", reply("the changed response", "APIResponse")},
+				{"400", errorReply("the json could not be read")},
+				{"401", errorReply("the api token is missing or wrong")},
+				{"404", notFound},
+				{"422", errorReply("the changes did not pass validation")},
+			}},
+		}},
+		{"delete", jsonObject{
+			{"summary", "Delete a response"},
+			{"security", security},
+			{"responses", jsonObject{
+				{"204", jsonObject{{"description", "the response was deleted"}}},
+				{"401", errorReply("the api token is missing or wrong")},
+				{"404", notFound},
+			}},
+		}},
+	})
+
+	var statusSchema interface{} = str
+	if len(f.Statuses) > 0 {
+		statusSchema = jsonObject{{"type", "string"}, {"enum", f.Statuses}}
+	}
+	schemas.set("APIResponse", object("a stored response", jsonObject{
+		{"id", str},
+		{"answers", ref("FormAnswer")},
+		{"meta", ref("ResponseMeta")},
+	}, "id", "answers", "meta"))
+	schemas.set("ResponseMeta", object("what is known about a response apart from its answers", jsonObject{
+		{"created", timestamp},
+		{"updated", timestamp},
+		{"form_hash", jsonObject{{"type", "string"}, {"description", "the version of the form the answers were given to"}}},
+		{"revisions", jsonObject{{"type", "array"}, {"items", object("an earlier version of the answers", jsonObject{
+			{"replaced", timestamp},
+			{"by", str},
+			{"form_hash", str},
+			{"answers", jsonObject{{"type", "object"}}},
+		}, "replaced", "answers")}}},
+		{"status", jsonObject{{"type", "array"}, {"description", "the history of the response's status, oldest first"}, {"items", object("a change of status", jsonObject{
+			{"status", statusSchema},
+			{"message", str},
+			{"time", timestamp},
+		}, "status", "time")}}},
+	}, "created"))
+	schemas.set("APIList", object("a page of responses", jsonObject{
+		{"responses", jsonObject{{"type", "array"}, {"items", ref("APIResponse")}}},
+		{"next_cursor", jsonObject{{"type", "string"}, {"description", "gets the next page when passed as the cursor, empty on the last page"}}},
+	}, "responses", "next_cursor"))
+	schemas.set("APIPatch", object("changes to a response", jsonObject{
+		{"answers", jsonObject{{"type", "object"}, {"description", "the answers to change, shaped like FormAnswer"}}},
+		{"status", statusSchema},
+		{"message", jsonObject{{"type", "string"}, {"description", "a message kept with the change of status"}}},
+	}))
+	schemas.set("APIErrors", object("what went wrong", jsonObject{
+		{"errors", jsonObject{{"type", "array"}, {"items", ref("FieldError")}}},
+	}, "errors"))
+}
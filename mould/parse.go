@@ -0,0 +1,709 @@
+package mould
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"mould/store"
+)
+
+// Diagnostic describes a single problem found while parsing a form format file. all diagnostics for a file are
+// collected before anything is generated, so that every mistake can be fixed in one go
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	Text    string // the full source line the problem was found on
+}
+
+func (d Diagnostic) String() string {
+	// point a caret at the offending column, reusing any tabs in the source line so that the caret lines up
+	var caret strings.Builder
+	for i, r := range []rune(d.Text) {
+		if i >= d.Column-1 {
+			break
+		}
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return fmt.Sprintf("%s:%d:%d: %s\n\t%s\n\t%s", d.File, d.Line, d.Column, d.Message, d.Text, caret.String())
+}
+
+// elements that configure the form page as a whole, and which never take a [title] or #key
+var settingElements = map[string]bool{
+	"form-title": true, "form-desc": true, "form-image": true, "form-password": true, "form-user": true,
+	"form-bg": true, "form-titlecolor": true, "form-fg": true, "form-paragraph": true,
+	"form-admin-user": true, "form-admin-password": true, "form-editable": true,
+	"form-status": true, "form-api-tokens": true, "form-webhook": true, "form-webhook-secret": true,
+	"form-notify": true, "form-confirm": true,
+}
+
+// keys that fields can't be stored under: the columns every export starts with, and the response's metadata. nor can
+// they use the apiParameters
+var reservedKeys = map[string]bool{"id": true, "submitted": true, store.MetaKey: true}
+
+// settings that can be declared more than once
+var repeatedSettings = map[string]bool{"form-paragraph": true, "form-webhook": true}
+
+// elements that end up as inputs in the form, and as fields on the generated FormAnswer
+var fieldElements = map[string]bool{
+	"input": true, "textarea": true, "hidden": true, "email": true, "number": true, "range": true, "radio": true,
+	"checkbox": true, "checkboxes": true, "select": true, "date": true,
+}
+
+// elements whose content is a comma-separated list of options to choose between
+var optionElements = map[string]bool{"radio": true, "checkboxes": true}
+
+// elements whose content may span several lines using the <<WORD syntax
+var multilineElements = map[string]bool{"form-desc": true, "form-paragraph": true, "textarea": true}
+
+// the options understood by number and range elements, in the order they are rendered as attributes
+var numberOptions = []string{"min", "max", "step", "value"}
+
+// the options understood by date elements, whose values are formatted as yyyy-mm-dd
+var dateOptions = []string{"min", "max", "value"}
+
+// DateLayout is how dates are written in the form format, and how date inputs submit them
+const DateLayout = "2006-01-02"
+
+// parseEditable parses the value of form-editable: true, false or until=<yyyy-mm-dd>, the last day on which responses
+// can be changed
+func parseEditable(value string) (editable bool, until string, err error) {
+	switch value = strings.TrimSpace(value); {
+	case value == "true":
+		return true, "", nil
+	case value == "false":
+		return false, "", nil
+	case strings.HasPrefix(value, "until="):
+		until = strings.TrimSpace(strings.TrimPrefix(value, "until="))
+		if _, err = time.Parse(DateLayout, until); err != nil {
+			return false, "", fmt.Errorf("until must be a date formatted as yyyy-mm-dd, got %q", until)
+		}
+		return true, until, nil
+	}
+	return false, "", fmt.Errorf("expected true, false or until=<yyyy-mm-dd>, got %q", value)
+}
+
+// parseStatuses parses the value of form-status: the statuses a response moves through, in order
+func parseStatuses(value string) ([]string, error) {
+	var statuses []string
+	for _, status := range strings.Split(value, ",") {
+		status = strings.TrimSpace(status)
+		if status == "" {
+			return nil, fmt.Errorf("empty status")
+		}
+		if contains(statuses, status) {
+			return nil, fmt.Errorf("status %q is listed more than once", status)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// minTokenLength is how long api tokens must at least be, so that they can't be guessed
+const minTokenLength = 16
+
+// parseTokens parses the value of form-api-tokens: the bearer tokens that give access to the api, separated by commas
+func parseTokens(value string) ([]string, error) {
+	var tokens []string
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		if err := checkToken(token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+func checkToken(token string) error {
+	if strings.ContainsAny(token, " \t") {
+		return fmt.Errorf("tokens cannot contain whitespace")
+	}
+	if len(token) < minTokenLength {
+		return fmt.Errorf("tokens must be at least %d characters long", minTokenLength)
+	}
+	return nil
+}
+
+// checkWebhook checks the value of form-webhook: the url payloads about responses are posted to
+func checkWebhook(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("expected an http:// or https:// url, got %q", value)
+	}
+	return nil
+}
+
+// parseAddresses parses the value of form-notify: the email addresses told about new responses, separated by commas
+func parseAddresses(value string) ([]string, error) {
+	var addresses []string
+	for _, address := range strings.Split(value, ",") {
+		address = strings.TrimSpace(address)
+		parsed, err := mail.ParseAddress(address)
+		if err != nil || parsed.Name != "" {
+			return nil, fmt.Errorf("expected email addresses separated by commas, got %q", address)
+		}
+		addresses = append(addresses, parsed.Address)
+	}
+	return addresses, nil
+}
+
+// elements whose content is a list of name=value options
+var elementOptions = map[string][]string{"number": numberOptions, "range": numberOptions, "date": dateOptions}
+
+// optionNumber parses the value of a number, range or date option into a number, so that options can be both checked
+// and compared with each other
+func optionNumber(element, value string) (float64, error) {
+	if element == "date" {
+		t, err := time.Parse(DateLayout, value)
+		if err != nil {
+			return 0, fmt.Errorf("must be a date formatted as yyyy-mm-dd, got %q", value)
+		}
+		return float64(t.Unix()), nil
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number, got %q", value)
+	}
+	return n, nil
+}
+
+// column converts a byte offset in line into a 1-indexed column counted in characters
+func column(line string, offset int) int {
+	if offset > len(line) {
+		offset = len(line)
+	}
+	return len([]rune(line[:offset])) + 1
+}
+
+// parseFile parses a form format file into its syntax tree, reporting every problem it finds along the way.
+// declarations with problems are left out
+func parseFile(filename, format string) (*File, []Diagnostic) {
+	lines := strings.Split(strings.ReplaceAll(format, "\r\n", "\n"), "\n")
+	file := &File{}
+	var diagnostics []Diagnostic
+	// comments and blank lines since the last declaration, with "" for a blank line
+	var leading []string
+	// used to detect the same key (or the same form setting) being declared twice
+	seenKeys := make(map[string]int)
+	seenNames := make(map[string]int)
+	seenSettings := make(map[string]int)
+	for i := 0; i < len(lines); i++ {
+		lineno := i + 1
+		line := lines[i]
+		// blank lines and comments are ignored, other than being kept around for formatting
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+			if trimmed != "" || (len(leading) > 0 && leading[len(leading)-1] != "") {
+				leading = append(leading, trimmed)
+			} else if len(leading) == 0 && len(file.Decls) > 0 {
+				leading = append(leading, "")
+			}
+			continue
+		}
+		report := func(offset int, msg string, args ...interface{}) {
+			diagnostics = append(diagnostics, Diagnostic{
+				File:    filename,
+				Line:    lineno,
+				Column:  column(line, offset),
+				Message: fmt.Sprintf(msg, args...),
+				Text:    line,
+			})
+		}
+		splitterIndex := strings.Index(line, "=")
+		if splitterIndex == -1 {
+			report(len(line), `missing "=" between element and content`)
+			continue
+		}
+
+		var kind, title, rawKey string
+		var required bool
+		value := strings.TrimSpace(line[splitterIndex+1:])
+		// problems with the value are pointed out where it starts, or right after the "=" if there is none
+		valuePos := splitterIndex + 1 + len(line[splitterIndex+1:]) - len(strings.TrimLeft(line[splitterIndex+1:], " \t"))
+		if value == "" {
+			valuePos = splitterIndex + 1
+		}
+		// a value of <<WORD starts a multi-line value, which runs until a line containing only WORD. the body is consumed
+		// up front so that it is never mistaken for declarations, even if the declaration itself turns out to be broken
+		multiline := false
+		if terminator, ok := heredocTerminator(value); ok {
+			var body []string
+			closed := false
+			for i+1 < len(lines) {
+				i++
+				if strings.TrimSpace(lines[i]) == terminator {
+					closed = true
+					break
+				}
+				body = append(body, lines[i])
+			}
+			if !closed {
+				report(valuePos, "multi-line value is never closed: missing a line containing only %s", terminator)
+				continue
+			}
+			value = dedent(body)
+			multiline = true
+		}
+
+		// walk the left hand side: [!]element[[title]][#key], keeping track of where we are in the line for diagnostics
+		left := line[:splitterIndex]
+		pos := len(left) - len(strings.TrimLeft(left, " \t"))
+		left = strings.TrimSpace(left)
+		if strings.HasPrefix(left, "!") {
+			required = true
+			left = left[1:]
+			pos++
+		}
+		nameEnd := strings.IndexAny(left, "[#")
+		if nameEnd == -1 {
+			nameEnd = len(left)
+		}
+		kind = left[:nameEnd]
+		elementPos := pos
+		rest := left[nameEnd:]
+		pos += nameEnd
+		if kind == "" {
+			report(elementPos, "missing element name")
+			continue
+		}
+		if strings.ContainsAny(kind, " \t") {
+			report(elementPos, "malformed element %q: element names cannot contain whitespace", kind)
+			continue
+		}
+		// where the title and #key start, for problems with the field name made from them
+		namePos := pos
+		if strings.HasPrefix(rest, "[") {
+			namePos = pos + 1
+			closing := strings.LastIndex(rest, "]")
+			if closing == -1 {
+				report(pos, `unterminated [title]: missing "]"`)
+				continue
+			}
+			title = rest[1:closing]
+			if strings.TrimSpace(title) == "" {
+				report(pos, "empty [title]")
+				continue
+			}
+			rest = rest[closing+1:]
+			pos += closing + 1
+		}
+		if strings.HasPrefix(rest, "#") {
+			namePos = pos + 1
+			rawKey = strings.TrimSpace(rest[1:])
+			if rawKey == "" {
+				report(pos, "empty #key")
+				continue
+			}
+			if strings.ContainsAny(rawKey, " \t#[]") {
+				report(pos, "malformed #key %q: keys cannot contain whitespace, '#', '[' or ']'", rawKey)
+				continue
+			}
+		} else if strings.TrimSpace(rest) != "" {
+			report(pos, "unexpected %q after [title]: expected #key or \"=\"", strings.TrimSpace(rest))
+			continue
+		}
+
+		node := Node{Line: lineno}
+		var field *FieldDecl
+		switch {
+		case settingElements[kind]:
+			if required {
+				report(elementPos-1, "%s is a form setting and cannot be required", kind)
+				continue
+			}
+			if title != "" || rawKey != "" {
+				report(elementPos+len(kind), "%s is a form setting and does not take a [title] or #key", kind)
+				continue
+			}
+			if first, ok := seenSettings[kind]; ok && !repeatedSettings[kind] {
+				report(elementPos, "%s is already set on line %d", kind, first)
+				continue
+			}
+			if _, ok := seenSettings[kind]; !ok {
+				seenSettings[kind] = lineno
+			}
+		case fieldElements[kind]:
+			if title == "" {
+				report(elementPos+len(kind), "%s is missing a [title]", kind)
+				continue
+			}
+			key, name := keyAndName(title, rawKey)
+			if name == "" {
+				report(namePos, "%s has no letters or digits to name its field after; set a #key that does", kind)
+				continue
+			}
+			if reservedKeys[key] {
+				report(namePos, "the key %q is reserved for the id, submission time and metadata of responses; set a different #key", key)
+				continue
+			}
+			if apiParameters[key] {
+				report(namePos, "the key %q is reserved for the query parameters of /api/responses, which couldn't filter on it; set a different #key", key)
+				continue
+			}
+			if first, ok := seenKeys[key]; ok {
+				report(elementPos, "duplicate key %q, first declared on line %d", key, first)
+				continue
+			}
+			if first, ok := seenNames[name]; ok {
+				report(elementPos, "field name %s clashes with the field declared on line %d; set a different #key", name, first)
+				continue
+			}
+			seenKeys[key] = lineno
+			seenNames[name] = lineno
+			field = &FieldDecl{Node: node, Kind: kind, Title: title, Required: required, Key: key, Name: name, HasKey: rawKey != ""}
+		default:
+			report(elementPos, "unknown element %q", kind)
+			continue
+		}
+
+		if optionElements[kind] && strings.Trim(value, ", \t") == "" {
+			report(valuePos, "%s needs at least one option", kind)
+			continue
+		}
+
+		var selectContent *SelectContent
+		if kind == "select" {
+			var err error
+			if selectContent, err = parseSelectOptions(value); err != nil {
+				report(valuePos, "%s: %s", kind, err)
+				continue
+			}
+		}
+
+		if kind == "form-editable" {
+			if _, _, err := parseEditable(value); err != nil {
+				report(valuePos, "form-editable: %s", err)
+				continue
+			}
+		}
+
+		if kind == "form-status" {
+			if _, err := parseStatuses(value); err != nil {
+				report(valuePos, "form-status: %s", err)
+				continue
+			}
+		}
+
+		if kind == "form-api-tokens" {
+			if _, err := parseTokens(value); err != nil {
+				report(valuePos, "form-api-tokens: %s", err)
+				continue
+			}
+		}
+
+		if kind == "form-webhook" {
+			if err := checkWebhook(value); err != nil {
+				report(valuePos, "form-webhook: %s", err)
+				continue
+			}
+		}
+
+		if kind == "form-webhook-secret" && len(value) < minTokenLength {
+			report(valuePos, "form-webhook-secret must be at least %d characters long", minTokenLength)
+			continue
+		}
+
+		if kind == "form-notify" {
+			if _, err := parseAddresses(value); err != nil {
+				report(valuePos, "form-notify: %s", err)
+				continue
+			}
+		}
+
+		var pattern *regexp.Regexp
+		if kind == "email" && value != "" {
+			var err error
+			if pattern, err = regexp.Compile(anchoredPattern(value)); err != nil {
+				report(valuePos, "email pattern is not a valid regular expression: %s", err)
+				continue
+			}
+		}
+
+		if multiline && !multilineElements[kind] {
+			report(valuePos, "%s does not support multi-line values", kind)
+			continue
+		}
+
+		options := make(map[string]string)
+		if allowed, ok := elementOptions[kind]; ok {
+			valueStart := splitterIndex + 1
+			ok := true
+			for _, optionPair := range strings.Split(line[valueStart:], ",") {
+				optionPos := valueStart + len(optionPair) - len(strings.TrimLeft(optionPair, " \t"))
+				valueStart += len(optionPair) + 1
+				optionPair = strings.TrimSpace(optionPair)
+				if optionPair == "" {
+					if value != "" {
+						report(optionPos, "empty %s option", kind)
+						ok = false
+					}
+					continue
+				}
+				parts := strings.SplitN(optionPair, "=", 2)
+				if len(parts) != 2 {
+					report(optionPos, "malformed %s option %q: expected name=value", kind, optionPair)
+					ok = false
+					continue
+				}
+				name, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+				if !contains(allowed, name) {
+					report(optionPos, "unknown %s option %q: expected one of %s", kind, name, strings.Join(allowed, ", "))
+					ok = false
+					continue
+				}
+				if _, err := optionNumber(kind, val); err != nil {
+					report(optionPos, "%s option %s %s", kind, name, err)
+					ok = false
+					continue
+				}
+				if _, exists := options[name]; exists {
+					report(optionPos, "%s option %s is set more than once", kind, name)
+					ok = false
+					continue
+				}
+				options[name] = val
+			}
+			if min, hasMin := options["min"]; ok && hasMin {
+				if max, hasMax := options["max"]; hasMax {
+					lo, _ := optionNumber(kind, min)
+					hi, _ := optionNumber(kind, max)
+					if lo > hi {
+						report(valuePos, "%s option min=%s is larger than max=%s", kind, min, max)
+						ok = false
+					}
+				}
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		node.Leading = leading
+		leading = nil
+		if field == nil {
+			file.Decls = append(file.Decls, &SettingDecl{Node: node, Kind: kind, Value: value})
+			continue
+		}
+		field.Node = node
+		switch kind {
+		case "number", "range":
+			field.Content = &NumberContent{Min: options["min"], Max: options["max"], Step: options["step"], Value: options["value"]}
+		case "date":
+			field.Content = &DateContent{Min: options["min"], Max: options["max"], Value: options["value"]}
+		case "radio", "checkboxes":
+			choices := &ChoiceContent{}
+			for _, option := range strings.Split(value, ",") {
+				choices.Options = append(choices.Options, strings.TrimSpace(option))
+			}
+			field.Content = choices
+		case "select":
+			field.Content = selectContent
+		case "checkbox":
+			field.Content = &CheckboxContent{Label: value}
+		case "email":
+			field.Content = &EmailContent{Pattern: value, pattern: pattern}
+		default:
+			field.Content = &TextContent{Text: value}
+		}
+		file.Decls = append(file.Decls, field)
+	}
+	file.Trailing = leading
+	// webhooks are signed with the secret, so one can't be declared without the other
+	if line, ok := seenSettings["form-webhook"]; ok {
+		if _, ok := seenSettings["form-webhook-secret"]; !ok {
+			diagnostics = append(diagnostics, Diagnostic{
+				File:    filename,
+				Line:    line,
+				Column:  1,
+				Message: "form-webhook needs a form-webhook-secret to sign its payloads with",
+				Text:    lines[line-1],
+			})
+		}
+	}
+	// confirmations are sent to the address respondents give in one of the form's email fields, which may be declared
+	// anywhere in the form
+	var emailKeys, quoted []string
+	for _, field := range file.Fields() {
+		if field.Kind == "email" {
+			emailKeys = append(emailKeys, field.Key)
+			quoted = append(quoted, strconv.Quote(field.Key))
+		}
+	}
+	for _, decl := range file.Decls {
+		setting, ok := decl.(*SettingDecl)
+		if !ok || setting.Kind != "form-confirm" || contains(emailKeys, setting.Value) {
+			continue
+		}
+		message := fmt.Sprintf("form-confirm: %q is not the key of an email field", setting.Value)
+		if len(emailKeys) > 0 {
+			message += fmt.Sprintf(", expected one of %s", strings.Join(quoted, ", "))
+		} else {
+			message += ", and the form has none"
+		}
+		text := lines[setting.Line-1]
+		diagnostics = append(diagnostics, Diagnostic{
+			File:    filename,
+			Line:    setting.Line,
+			Column:  column(text, strings.Index(text, "=")+1),
+			Message: message,
+			Text:    text,
+		})
+	}
+	return file, diagnostics
+}
+
+// parseSelectOptions parses the content of a select element: comma-separated options, optionally split into labelled
+// groups with `|` (`Group A: x, y | Group B: z`), where an item of the form `default=<option>` preselects an option
+func parseSelectOptions(value string) (*SelectContent, error) {
+	content := &SelectContent{}
+	seen := make(map[string]bool)
+	groupDecls := strings.Split(value, "|")
+	for _, groupDecl := range groupDecls {
+		var group OptionGroup
+		if colon := strings.Index(groupDecl, ":"); colon != -1 {
+			group.Label = strings.TrimSpace(groupDecl[:colon])
+			groupDecl = groupDecl[colon+1:]
+			if group.Label == "" {
+				return nil, fmt.Errorf("option group is missing a label before the \":\"")
+			}
+		} else if len(groupDecls) > 1 {
+			return nil, fmt.Errorf("option group %q is missing a label: expected `Label: option, option`", strings.TrimSpace(groupDecl))
+		}
+		for _, option := range strings.Split(groupDecl, ",") {
+			option = strings.TrimSpace(option)
+			if option == "" {
+				continue
+			}
+			if strings.HasPrefix(option, "default=") {
+				if content.Default != "" {
+					return nil, fmt.Errorf("default is set more than once")
+				}
+				content.Default = strings.TrimSpace(strings.TrimPrefix(option, "default="))
+				continue
+			}
+			if seen[strings.ToLower(option)] {
+				return nil, fmt.Errorf("option %q is listed more than once", option)
+			}
+			seen[strings.ToLower(option)] = true
+			group.Options = append(group.Options, option)
+		}
+		if len(group.Options) == 0 {
+			if group.Label != "" {
+				return nil, fmt.Errorf("option group %q has no options", group.Label)
+			}
+			continue
+		}
+		content.Groups = append(content.Groups, group)
+	}
+	if len(content.Groups) == 0 {
+		return nil, fmt.Errorf("needs at least one option")
+	}
+	if content.Default != "" && !seen[strings.ToLower(content.Default)] {
+		return nil, fmt.Errorf("default %q is not one of the options", content.Default)
+	}
+	return content, nil
+}
+
+var heredocPattern = regexp.MustCompile(`^<<([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// heredocTerminator returns the word that closes a multi-line value, if value opens one
+func heredocTerminator(value string) (string, bool) {
+	matches := heredocPattern.FindStringSubmatch(value)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// dedent strips the indentation shared by all lines of a multi-line value, as well as any leading and trailing blank
+// lines, so that the body can be indented to match the rest of the form file
+func dedent(body []string) string {
+	indent := -1
+	for i, line := range body {
+		body[i] = strings.TrimRight(line, " \t")
+		if body[i] == "" {
+			continue
+		}
+		lineIndent := len(body[i]) - len(strings.TrimLeft(body[i], " \t"))
+		if indent == -1 || lineIndent < indent {
+			indent = lineIndent
+		}
+	}
+	for i, line := range body {
+		if len(line) >= indent && indent > 0 {
+			body[i] = line[indent:]
+		}
+	}
+	return strings.Trim(strings.Join(body, "\n"), "\n")
+}
+
+// paragraphs splits text on blank lines, so that multi-line descriptions can contain several paragraphs
+func paragraphs(text string) []string {
+	var list []string
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// anchoredPattern turns the pattern of an email element into a regex matching the whole answer, like html does
+func anchoredPattern(pattern string) string {
+	return fmt.Sprintf("^(?:%s)$", pattern)
+}
+
+// keyAndName works out the key a field's answers are stored under, and the name of its field on the generated
+// FormAnswer, from its title and the #key it was declared with, if any
+func keyAndName(title, key string) (string, string) {
+	if len(key) > 0 {
+		return key, identifier(key)
+	}
+	return strings.ToLower(title), identifier(title)
+}
+
+// identifier turns a title or #key into the name of an exported Go field: every run of letters, digits and underscores
+// becomes a capitalised word, and everything else (spaces, dashes, punctuation) is dropped, e.g. "E-mail" becomes
+// EMail. names that wouldn't start with an upper case letter, like the one for "1st name", are prefixed with Field. the
+// name is "" if there is nothing to name the field after
+func identifier(s string) string {
+	var name []rune
+	capitalise := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			capitalise = true
+			continue
+		}
+		if capitalise {
+			r = unicode.ToUpper(r)
+			capitalise = false
+		}
+		name = append(name, r)
+	}
+	if len(name) > 0 && !unicode.IsUpper(name[0]) {
+		return "Field" + string(name)
+	}
+	return string(name)
+}
@@ -0,0 +1,91 @@
+package mould_test
+
+import (
+	"strings"
+	"testing"
+
+	"mould/mould"
+)
+
+// the query parameters of /api/responses can't be field keys, whether they come from a title or a #key, as the api
+// couldn't filter on such fields
+func TestAPIParameterKeys(t *testing.T) {
+	for _, format := range []string{
+		"input[Status] = where it's at",
+		"number[Limit] = min=0",
+		"date[Since] =",
+		"date[Until] =",
+		"input[Position]#cursor = where the cursor is",
+	} {
+		_, diagnostics := mould.ParseFormat("form.mould", format+"\n")
+		if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "reserved for the query parameters of /api/responses") {
+			t.Errorf("%s: got %v, expected the key to be reserved", format, diagnostics)
+		}
+	}
+	if _, diagnostics := mould.ParseFormat("form.mould", "input[Status]#order_status = where it's at\n"); len(diagnostics) > 0 {
+		t.Errorf("got %v, expected a field with another #key to be fine", diagnostics)
+	}
+}
+
+// diagnostics point at the line and column the problem is found at
+func TestDiagnostics(t *testing.T) {
+	for _, test := range []struct {
+		name, format string
+		line, column int
+		message      string
+	}{
+		{
+			name:    "title without letters",
+			format:  "form-title = Hi\n!input[???] = nothing to name it after\n",
+			line:    2,
+			column:  8,
+			message: "input has no letters or digits to name its field after; set a #key that does",
+		},
+		{
+			name:    "reserved title",
+			format:  "form-title = Hi\ninput[Submitted] = when\n",
+			line:    2,
+			column:  7,
+			message: `the key "submitted" is reserved for the id, submission time and metadata of responses; set a different #key`,
+		},
+		{
+			name:    "reserved #key",
+			format:  "form-title = Hi\ninput[Name] = x\n  number[Count]#id = min=1\n",
+			line:    3,
+			column:  17,
+			message: `the key "id" is reserved for the id, submission time and metadata of responses; set a different #key`,
+		},
+		{
+			name:    "unclosed heredoc",
+			format:  "form-title = Hi\ntextarea[Bio] = <<END\nline one\nline two\n",
+			line:    2,
+			column:  17,
+			message: "multi-line value is never closed: missing a line containing only END",
+		},
+		{
+			name:    "webhook without secret",
+			format:  "form-title = Hi\ninput[Name] = x\nform-webhook = https://example.org/hook\n",
+			line:    3,
+			column:  1,
+			message: "form-webhook needs a form-webhook-secret to sign its payloads with",
+		},
+		{
+			name:    "short webhook secret",
+			format:  "form-webhook = https://example.org/hook\nform-webhook-secret =   short\n",
+			line:    2,
+			column:  25,
+			message: "form-webhook-secret must be at least 16 characters long",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, diagnostics := mould.ParseFormat("form.mould", test.format)
+			if len(diagnostics) != 1 {
+				t.Fatalf("got %d diagnostics, expected 1: %v", len(diagnostics), diagnostics)
+			}
+			d := diagnostics[0]
+			if d.File != "form.mould" || d.Line != test.line || d.Column != test.column || d.Message != test.message {
+				t.Errorf("got %s:%d:%d: %s\nexpected form.mould:%d:%d: %s", d.File, d.Line, d.Column, d.Message, test.line, test.column, test.message)
+			}
+		})
+	}
+}
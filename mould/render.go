@@ -0,0 +1,363 @@
+package mould
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+type styleData struct {
+	Background, TitleColor, Body template.HTML
+}
+
+type templateData struct {
+	Header, Footer, Content template.HTML
+	Stylesheet              template.CSS
+	Title                   string
+}
+
+// Page is what a form is dressed in on top of its format: html shown above and below the form, a stylesheet that
+// fully replaces mould's default styling, and a template that replaces the receipt. all of them are optional
+type Page struct {
+	Header, Footer, Stylesheet, Receipt string
+}
+
+var stylesheetTemplate = `<style>
+		html {
+			{{ if .Background }} background: {{ .Background }}; {{ end }}
+			{{ if .Body }} color: {{ .Body }}; {{ end }}
+			padding-left: 2rem;
+			padding-right: 2rem;
+			padding-top: 1rem;
+		}
+		h1 {
+			{{ if .TitleColor }} color: {{ .TitleColor }}; {{ end }}
+		}
+		* {
+			padding: 0;
+			margin-bottom: 0.5rem;
+		}
+		div {
+			display: grid;
+			max-width: 600px;
+			align-items: center;
+		}
+		.error {
+			color: firebrick;
+		}
+		.receipt dt {
+			font-weight: bold;
+		}
+		.receipt dd {
+			margin-left: 1rem;
+			white-space: pre-wrap;
+		}
+		.timeline {
+			list-style: none;
+			border-left: 2px solid currentColor;
+			padding-left: 1rem;
+		}
+		.timeline .current {
+			font-weight: bold;
+		}
+		.timeline .upcoming {
+			opacity: 0.5;
+		}
+</style>
+`
+
+var htmlTemplate = `<!DOCTYPE html>
+<html>
+	<head>
+		<title>{{ .Title }}</title>
+		{{ if .Stylesheet }} 
+		<style>
+			{{ .Stylesheet }} 
+		</style>
+		{{ end }}
+	</head>
+	<body>
+	{{ if .Header }} {{ .Header }} {{ end }}
+	{{ .Content }}
+	{{ if .Footer }} {{ .Footer }} {{ end }}
+	</body>
+</html>`
+
+var responseTemplate = `<!DOCTYPE html>
+<html>
+    <head>
+    <title>Form submitted</title>
+		%SENTINEL%
+    <body>
+			<h1>Response successful</h1>
+			<p>Submitted {{ .Submitted }}</p>
+			{{ if .Timeline }}
+			<h2>Status</h2>
+			<ol class="timeline">
+				{{ range .Timeline }}
+				<li class="{{ if .Current }}current{{ else if not .Time }}upcoming{{ end }}">
+					{{ .Status }}{{ if .Time }} <small>{{ .Time }}</small>{{ end }}
+					{{ if .Message }}<p>{{ .Message }}</p>{{ end }}
+				</li>
+				{{ end }}
+			</ol>
+			{{ end }}
+			<h2>Your response</h2>
+			<dl class="receipt">
+				{{ range .Fields }}
+				<dt>{{ .Label }}</dt>
+				<dd>{{ if .Text }}{{ .Text }}{{ else }}&mdash;{{ end }}</dd>
+				{{ end }}
+			</dl>
+			{{ if .EditURL }}<p>Made a mistake? <a href="{{ .EditURL }}">Change your response</a></p>{{ end }}
+			<p><b>Bookmark this page</b> as a receipt or if you want to review what you responded some time in the future</p>
+	</body>
+</html>`
+
+// actionList collects the template actions that let the server fill in the generated form page with submitted values
+// and validation errors. the page is assembled with %ACTION-n% sentinels in their place, so that any "{{" in the
+// content of the form (or its header, footer and stylesheet) can be escaped before the actions are put back
+type actionList []string
+
+func (a *actionList) add(action string) string {
+	*a = append(*a, action)
+	return fmt.Sprintf("%%ACTION-%d%%", len(*a)-1)
+}
+
+// value fills in the submitted (or default) value for key
+func (a *actionList) value(key string) string {
+	return a.add(fmt.Sprintf(`{{ .Value %q }}`, key))
+}
+
+// error shows the validation error for key, if there is one
+func (a *actionList) error(key string) string {
+	return a.add(fmt.Sprintf(`{{ with .Error %q }}<p class="error">{{ . }}</p>{{ end }}`, key))
+}
+
+// attrIf sets a boolean attribute, like checked or selected, if value was submitted for key
+func (a *actionList) attrIf(attr, key, value string) string {
+	return a.add(fmt.Sprintf(`{{ if .Has %q %q }}%s{{ end }}`, key, value, attr))
+}
+
+func (a actionList) expand(page string) string {
+	page = strings.ReplaceAll(page, "{{", `{{"{{"}}`)
+	for i, action := range a {
+		page = strings.Replace(page, fmt.Sprintf("%%ACTION-%d%%", i), action, 1)
+	}
+	return page
+}
+
+// optionAttributes renders the options of a number, range or date field that are set as attributes, from pairs of
+// names and values
+func optionAttributes(options ...string) string {
+	var attributes string
+	for i := 0; i+1 < len(options); i += 2 {
+		if options[i+1] != "" {
+			attributes += fmt.Sprintf(`%s="%s" `, options[i], options[i+1])
+		}
+	}
+	return attributes
+}
+
+// RenderHTML renders the form page and the receipt page. both are html templates themselves: the form page is filled in
+// with IndexData, and the receipt with ReceiptData
+func (f *Form) RenderHTML(page Page) (index, receipt string) {
+	var htmlList []string
+	var actions actionList
+	for _, decl := range f.Syntax.Decls {
+		setting, ok := decl.(*SettingDecl)
+		if !ok {
+			continue
+		}
+		switch setting.Kind {
+		case "form-title":
+			htmlList = append(htmlList, fmt.Sprintf(`<h1>%s</h1>`, setting.Value))
+		case "form-desc":
+			for _, p := range paragraphs(setting.Value) {
+				htmlList = append(htmlList, fmt.Sprintf(`<p>%s</p>`, p))
+			}
+		case "form-image":
+			htmlList = append(htmlList, fmt.Sprintf(`<img src="%s">`, setting.Value))
+		}
+	}
+
+	// the form is posted to / for new responses, and to the response's edit page when changing one
+	htmlList = append(htmlList, fmt.Sprintf(`<form action="%s" method="post">`, actions.add(`{{ .Action }}`)))
+	htmlList = append(htmlList, actions.add(`{{ if .Errors }}<p class="error">Your response could not be saved, please correct the errors below</p>{{ end }}`))
+	for _, decl := range f.Syntax.Decls {
+		// paragraphs are shown between the fields they were declared between
+		if setting, ok := decl.(*SettingDecl); ok {
+			if setting.Kind == "form-paragraph" {
+				for _, p := range paragraphs(setting.Value) {
+					htmlList = append(htmlList, fmt.Sprintf(`<p>%s</p>`, p))
+				}
+			}
+			continue
+		}
+		input := decl.(*FieldDecl)
+		var required string
+		if input.Required {
+			required = `required`
+		}
+		key, title := input.Key, input.Name
+		switch input.Kind {
+		case "textarea":
+			htmlList = append(htmlList, "<div>")
+			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, title))
+			el := fmt.Sprintf(`<textarea %s placeholder="%s" name="%s">%s</textarea>`, required, input.Content.(*TextContent).Text, key, actions.value(key))
+			htmlList = append(htmlList, el)
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		case "input":
+			htmlList = append(htmlList, "<div>")
+			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, input.Title))
+			el := fmt.Sprintf(`<input type="text" %s placeholder="%s" name="%s" value="%s"/>`, required, input.Content.(*TextContent).Text, key, actions.value(key))
+			htmlList = append(htmlList, el)
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		case "hidden":
+			htmlList = append(htmlList, "<div>")
+			el := fmt.Sprintf(`<input type="hidden" %s value="%s" name="%s"/>`, required, input.Content.(*TextContent).Text, key)
+			htmlList = append(htmlList, el)
+			htmlList = append(htmlList, "</div>")
+		case "email":
+			htmlList = append(htmlList, "<div>")
+			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, input.Title))
+			el := fmt.Sprintf(`<input type="email" %s placeholder="email@provider.tld" pattern="%s", name="%s" value="%s"/>`, required, input.Content.(*EmailContent).Pattern, key, actions.value(key))
+			htmlList = append(htmlList, el)
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		case "number", "range":
+			content := input.Content.(*NumberContent)
+			// the value is filled in from the submitted (or default) values instead
+			options := optionAttributes("min", content.Min, "max", content.Max, "step", content.Step)
+			htmlList = append(htmlList, "<div>")
+			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, title))
+			el := fmt.Sprintf(`<input type="%s" %s %s name="%s" value="%s"/>`, input.Kind, required, options, key, actions.value(key))
+			htmlList = append(htmlList, el)
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		case "date":
+			content := input.Content.(*DateContent)
+			options := optionAttributes("min", content.Min, "max", content.Max)
+			htmlList = append(htmlList, "<div>")
+			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, input.Title))
+			el := fmt.Sprintf(`<input type="date" %s %s name="%s" value="%s"/>`, required, options, key, actions.value(key))
+			htmlList = append(htmlList, el)
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		case "radio":
+			htmlList = append(htmlList, "<div>")
+			htmlList = append(htmlList, fmt.Sprintf(`<span>%s</span>`, input.Title))
+			for _, option := range input.OptionLabels() {
+				radioValue := strings.ToLower(option)
+				radioId := fmt.Sprintf(`%s-option-%s`, key, radioValue)
+				htmlList = append(htmlList, "<span>")
+				el := fmt.Sprintf(`<input type="radio" %s id="%s" value="%s" name="%s" %s/>`, required, radioId, radioValue, key, actions.attrIf("checked", key, radioValue))
+				htmlList = append(htmlList, el)
+				htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, radioId, option))
+				htmlList = append(htmlList, "</span>")
+			}
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		case "select":
+			content := input.Content.(*SelectContent)
+			htmlList = append(htmlList, "<div>")
+			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, input.Title))
+			htmlList = append(htmlList, fmt.Sprintf(`<select %s id="%s" name="%s">`, required, key, key))
+			// without a default, start on an empty option so that `required` forces an active choice
+			if content.Default == "" {
+				htmlList = append(htmlList, `<option value=""></option>`)
+			}
+			for _, group := range content.Groups {
+				if group.Label != "" {
+					htmlList = append(htmlList, fmt.Sprintf(`<optgroup label="%s">`, group.Label))
+				}
+				for _, option := range group.Options {
+					optionValue := strings.ToLower(option)
+					htmlList = append(htmlList, fmt.Sprintf(`<option value="%s" %s>%s</option>`, optionValue, actions.attrIf("selected", key, optionValue), option))
+				}
+				if group.Label != "" {
+					htmlList = append(htmlList, "</optgroup>")
+				}
+			}
+			htmlList = append(htmlList, "</select>")
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		case "checkbox":
+			htmlList = append(htmlList, "<div>")
+			// without any content, the title itself is used as the checkbox's label
+			label := input.Content.(*CheckboxContent).Label
+			if label == "" {
+				label = input.Title
+			} else {
+				htmlList = append(htmlList, fmt.Sprintf(`<span>%s</span>`, input.Title))
+			}
+			htmlList = append(htmlList, "<span>")
+			el := fmt.Sprintf(`<input type="checkbox" %s id="%s" name="%s" %s/>`, required, key, key, actions.attrIf("checked", key, "on"))
+			htmlList = append(htmlList, el)
+			htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, key, label))
+			htmlList = append(htmlList, "</span>")
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		case "checkboxes":
+			htmlList = append(htmlList, "<div>")
+			htmlList = append(htmlList, fmt.Sprintf(`<span>%s</span>`, input.Title))
+			for _, option := range input.OptionLabels() {
+				checkboxValue := strings.ToLower(option)
+				checkboxId := fmt.Sprintf(`%s-option-%s`, key, checkboxValue)
+				htmlList = append(htmlList, "<span>")
+				// note: `required` is not set on the individual checkboxes, as that would require *every* option to be checked
+				el := fmt.Sprintf(`<input type="checkbox" id="%s" value="%s" name="%s" %s/>`, checkboxId, checkboxValue, key, actions.attrIf("checked", key, checkboxValue))
+				htmlList = append(htmlList, el)
+				htmlList = append(htmlList, fmt.Sprintf(`<label for="%s">%s</label>`, checkboxId, option))
+				htmlList = append(htmlList, "</span>")
+			}
+			htmlList = append(htmlList, actions.error(key))
+			htmlList = append(htmlList, "</div>")
+		}
+	}
+
+	htmlList = append(htmlList, `<div><button type="submit">Submit</button></div>`)
+	htmlList = append(htmlList, "</form>")
+
+	var data templateData
+	data.Title = f.Title
+	data.Content = template.HTML(strings.Join(htmlList, "\n"))
+	data.Header = template.HTML(page.Header)
+	data.Footer = template.HTML(page.Footer)
+
+	// a custom receipt fully replaces the default one
+	receipt = responseTemplate
+	if page.Receipt != "" {
+		receipt = page.Receipt
+	}
+	// a stylesheet that was passed in *fully* replaces the contents of stylesheetTemplate
+	if page.Stylesheet != "" {
+		data.Stylesheet = template.CSS(page.Stylesheet)
+		receipt = strings.ReplaceAll(receipt, "%SENTINEL%", fmt.Sprintf(`<style>%s</style>`, page.Stylesheet))
+	} else {
+		// render the stylesheet
+		var styleData styleData
+		if f.Theme.Background != "" {
+			styleData.Background = template.HTML(f.Theme.Background)
+		}
+		if f.Theme.Foreground != "" {
+			styleData.Body = template.HTML(f.Theme.Foreground)
+		}
+		if f.Theme.Title != "" {
+			styleData.TitleColor = template.HTML(f.Theme.Title)
+		}
+		t := template.Must(template.New("").Parse(stylesheetTemplate))
+		var styleBuf bytes.Buffer
+		t.Execute(&styleBuf, styleData)
+		data.Stylesheet = template.CSS(styleBuf.String())
+		receipt = strings.ReplaceAll(receipt, "%SENTINEL%", fmt.Sprintf(`<style>%s</style>`, styleBuf.String()))
+	}
+
+	var buf bytes.Buffer
+	t := template.Must(template.New("").Parse(htmlTemplate))
+	t.Execute(&buf, data)
+	return actions.expand(buf.String()), receipt
+}
@@ -0,0 +1,137 @@
+package mould
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// jsonObject is a json object whose keys are kept in the order they were added, so that schemas list the fields in the
+// order they are declared in the form
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+func (p jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, kv := range p {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, err := json.Marshal(kv.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(kv.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+func (p *jsonObject) set(key string, value interface{}) {
+	*p = append(*p, jsonField{key, value})
+}
+
+// JSONSchema describes the answers to the form, as they are stored and exported, as a JSON Schema (draft 2020-12)
+// document. Every field is a property named after its key, and the checks made on answers are carried over: required
+// fields, the options of radio, select and checkboxes fields, the min and max of numbers and the pattern of emails
+func (f *Form) JSONSchema() ([]byte, error) {
+	var schema, properties jsonObject
+	schema.set("$schema", "https://json-schema.org/draft/2020-12/schema")
+	if f.Title != "" {
+		schema.set("title", f.Title)
+	}
+	schema.set("type", "object")
+	required := []string{}
+	for _, v := range f.Syntax.Fields() {
+		properties.set(v.Key, fieldSchema(v))
+		if v.Required {
+			required = append(required, v.Key)
+		}
+	}
+	schema.set("properties", properties)
+	schema.set("required", required)
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// fieldSchema describes the answer to a field. answers that can be left empty are "" for text, and null for numbers
+// and dates
+func fieldSchema(v *FieldDecl) jsonObject {
+	var p jsonObject
+	p.set("title", v.Title)
+	// nullable is used for the types of numbers and dates, which are null when not answered
+	nullable := func(t string) interface{} {
+		if v.Required {
+			return t
+		}
+		return []string{t, "null"}
+	}
+	var options []string
+	for _, label := range v.OptionLabels() {
+		options = append(options, strings.ToLower(label))
+	}
+	switch v.Kind {
+	case "number", "range":
+		if v.IsFloat() {
+			p.set("type", nullable("number"))
+		} else {
+			p.set("type", nullable("integer"))
+		}
+		min, max := v.bounds()
+		if min != "" {
+			p.set("minimum", json.Number(min))
+		}
+		if max != "" {
+			p.set("maximum", json.Number(max))
+		}
+	case "date":
+		// dates are stored as the start of the day they name, e.g. 2024-05-01T00:00:00Z
+		p.set("type", nullable("string"))
+		p.set("format", "date-time")
+	case "checkbox":
+		p.set("type", "boolean")
+		if v.Required {
+			p.set("const", true)
+		}
+	case "checkboxes":
+		p.set("type", "array")
+		p.set("items", jsonObject{{"type", "string"}, {"enum", options}})
+		if v.Required {
+			p.set("minItems", 1)
+		}
+	case "radio", "select":
+		p.set("type", "string")
+		// a field that isn't required is stored as "" when it's not answered
+		if !v.Required {
+			options = append(options, "")
+		}
+		p.set("enum", options)
+	default:
+		p.set("type", "string")
+		if v.Required {
+			p.set("minLength", 1)
+		}
+		if pattern := v.Pattern(); pattern != "" {
+			// an email that isn't required can be left empty, which the pattern doesn't need to match
+			if !v.Required {
+				pattern = "^$|" + pattern
+			}
+			p.set("pattern", pattern)
+		}
+	}
+	return p
+}
@@ -0,0 +1,119 @@
+package mould
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// keys that can be written as typescript property names without quoting them
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// TypeScript writes typescript interfaces matching the generated Go code: FormAnswer, the answers as they are stored
+// and posted as json, FieldError, a problem found with one of them, SubmitResult, the reply to posting them, and the
+// types of the api
+func (f *Form) TypeScript() string {
+	var ts strings.Builder
+	title := f.Title
+	if title == "" {
+		title = "the form"
+	}
+	fmt.Fprintf(&ts, "// Code generated by mould from %s. DO NOT EDIT.\n\n", title)
+	ts.WriteString("/** The answers to the form, keyed by each field's key */\n")
+	ts.WriteString("export interface FormAnswer {\n")
+	for _, v := range f.Syntax.Fields() {
+		fmt.Fprintf(&ts, "  /** %s */\n", strings.ReplaceAll(v.Title, "*/", "* /"))
+		fmt.Fprintf(&ts, "  %s: %s;\n", typeScriptKey(v.Key), typeScriptType(v))
+	}
+	ts.WriteString("}\n\n")
+	ts.WriteString("/** An answer that did not pass validation */\n")
+	ts.WriteString("export interface FieldError {\n  key: string;\n  message: string;\n}\n")
+	ts.WriteString("\n/** The reply to answers posted as json. errors is empty if the answers were stored */\n")
+	ts.WriteString("export interface SubmitResult {\n  id: string;\n  receipt_url: string;\n  errors: FieldError[];\n}\n")
+
+	// the api's types, see api.go
+	status := "string"
+	if len(f.Statuses) > 0 {
+		var statuses []string
+		for _, s := range f.Statuses {
+			statuses = append(statuses, typeScriptString(s))
+		}
+		status = strings.Join(statuses, " | ")
+	}
+	ts.WriteString(`
+/** A stored response, as the api returns it */
+export interface APIResponse {
+  id: string;
+  answers: FormAnswer;
+  meta: ResponseMeta;
+}
+
+/** What is known about a response apart from its answers */
+export interface ResponseMeta {
+  created: string;
+  updated?: string;
+  form_hash?: string;
+  revisions?: Array<{ replaced: string; by?: string; form_hash?: string; answers: Record<string, unknown> }>;
+  status?: Array<{ status: ` + status + `; message?: string; time: string }>;
+}
+
+/** A page of responses. next_cursor gets the next page, and is "" on the last page */
+export interface APIList {
+  responses: APIResponse[];
+  next_cursor: string;
+}
+
+/** Changes to a response */
+export interface APIPatch {
+  answers?: Partial<FormAnswer>;
+  status?: ` + status + `;
+  message?: string;
+}
+`)
+	return ts.String()
+}
+
+func typeScriptKey(key string) string {
+	if identifierPattern.MatchString(key) {
+		return key
+	}
+	return typeScriptString(key)
+}
+
+func typeScriptString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// typeScriptType is the type of the answer to a field, as it's stored
+func typeScriptType(v *FieldDecl) string {
+	var options []string
+	for _, label := range v.OptionLabels() {
+		options = append(options, typeScriptString(strings.ToLower(label)))
+	}
+	switch v.Kind {
+	case "number", "range":
+		if v.Required {
+			return "number"
+		}
+		return "number | null"
+	case "date":
+		// dates are stored as the start of the day they name, e.g. "2024-05-01T00:00:00Z"
+		if v.Required {
+			return "string"
+		}
+		return "string | null"
+	case "checkbox":
+		return "boolean"
+	case "checkboxes":
+		return "Array<" + strings.Join(options, " | ") + ">"
+	case "radio", "select":
+		// a field that isn't required is stored as "" when it's not answered
+		if !v.Required {
+			options = append(options, `""`)
+		}
+		return strings.Join(options, " | ")
+	}
+	return "string"
+}
@@ -0,0 +1,145 @@
+package mould
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"syscall"
+	"time"
+
+	"mould/store"
+	"mould/webhook"
+)
+
+// the events payloads are posted to the form's webhooks for
+const (
+	EventCreated = "response.created"
+	EventUpdated = "response.updated"
+	EventDeleted = "response.deleted"
+)
+
+// WebhookPayload is posted to the form's webhooks when a response is submitted, changed or deleted. Response is the
+// response as the api returns it, and is left out for deleted responses
+type WebhookPayload struct {
+	Event      string       `json:"event"`
+	Time       time.Time    `json:"time"`
+	Form       string       `json:"form"`
+	FormHash   string       `json:"form_hash"`
+	ResponseID string       `json:"response_id"`
+	Response   *APIResponse `json:"response,omitempty"`
+}
+
+// OpenWebhooks opens the outbox that webhook deliveries are queued in, next to the responses stored at storePath so
+// that they survive restarts, and starts delivering them
+func OpenWebhooks(storePath string) (*webhook.Outbox, error) {
+	outbox, err := webhook.Open(storePath + ".webhooks.json")
+	if err != nil {
+		return nil, err
+	}
+	outbox.Start()
+	return outbox, nil
+}
+
+// notify queues a payload about a response for each of the form's webhooks. response is nil if it was deleted
+func (h *Handler) notify(event, id string, response store.Response) {
+	if h.Webhooks == nil || len(h.Form.Webhooks) == 0 {
+		return
+	}
+	payload := WebhookPayload{Event: event, Time: time.Now().UTC(), Form: h.Form.Title, FormHash: h.Form.Hash, ResponseID: id}
+	if response != nil {
+		r := apiResponse(id, response)
+		payload.Response = &r
+	}
+	b, err := json.Marshal(payload)
+	if err == nil {
+		err = h.Webhooks.Enqueue(event, id, b, h.Form.Webhooks, h.Form.WebhookSecret)
+	}
+	if err != nil {
+		fmt.Println("err queueing webhook deliveries", err)
+	}
+}
+
+var adminWebhooksTemplate = `<!DOCTYPE html>
+<html>
+	<head>
+		<title>Webhook deliveries</title>
+		` + adminStyle + `
+	</head>
+	<body>
+		<h1>Webhook deliveries</h1>
+		{{ if .Error }}<p class="error">{{ .Error }}</p>{{ end }}
+		{{ if .Webhooks }}
+		<p>Payloads about new, changed and deleted responses are posted to:</p>
+		<ul>{{ range .Webhooks }}<li>{{ . }}</li>{{ end }}</ul>
+		{{ else }}
+		<p>The form declares no webhooks at the moment.</p>
+		{{ end }}
+		<table>
+			<thead>
+				<tr><th>queued</th><th>event</th><th>response</th><th>url</th><th>state</th><th>attempts</th><th>last result</th><th></th></tr>
+			</thead>
+			<tbody>
+				{{ range .Deliveries }}
+				<tr>
+					<td>{{ .Queued }}</td>
+					<td>{{ .Event }}</td>
+					<td><a href="{{ $.Base }}/admin/response/{{ .ResponseID }}">{{ .ResponseID }}</a></td>
+					<td>{{ .URL }}</td>
+					<td>{{ .State }}{{ if .NextAttempt }}, next attempt {{ .NextAttempt }}{{ end }}</td>
+					<td>{{ .Attempts }}</td>
+					<td>{{ .LastResult }}</td>
+					<td>{{ if ne .State "delivered" }}<form method="post"><input type="hidden" name="id" value="{{ .ID }}"/><button type="submit" name="action" value="retry">Retry now</button></form>{{ end }}</td>
+				</tr>
+				{{ end }}
+			</tbody>
+		</table>
+		<p><a href="{{ .Base }}/admin/">Back to all responses</a></p>
+	</body>
+</html>`
+
+var adminWebhooks = template.Must(template.New("admin-webhooks").Parse(adminWebhooksTemplate))
+
+// AdminWebhooksData is passed to the template showing the log of webhook deliveries
+type AdminWebhooksData struct {
+	Base       string
+	Webhooks   []string
+	Deliveries []AdminDelivery
+	Error      string
+}
+
+type AdminDelivery struct {
+	webhook.Delivery
+	Queued string
+	// NextAttempt is when a pending delivery is attempted again, or "" if it isn't pending
+	NextAttempt string
+}
+
+// adminDeliveries shows the log of webhook deliveries, and retries deliveries when asked to
+func (h *Handler) adminDeliveries(res http.ResponseWriter, req *http.Request) {
+	data := AdminWebhooksData{Base: h.Base, Webhooks: h.Form.Webhooks}
+	if h.Webhooks == nil {
+		http.Error(res, "Webhooks are not enabled on this server", http.StatusNotFound)
+		return
+	}
+	if req.Method == "POST" && req.PostFormValue("action") == "retry" {
+		if err := h.Webhooks.Retry(req.PostFormValue("id")); err != nil {
+			data.Error = err.Error()
+		} else {
+			http.Redirect(res, req, h.url("/admin/webhooks"), http.StatusSeeOther)
+			return
+		}
+	}
+	for _, d := range h.Webhooks.Deliveries() {
+		delivery := AdminDelivery{Delivery: d, Queued: formatTime(d.Created)}
+		if d.State == webhook.Pending {
+			delivery.NextAttempt = formatTime(d.NextAttempt)
+		}
+		data.Deliveries = append(data.Deliveries, delivery)
+	}
+	err := adminWebhooks.Execute(res, data)
+	if err != nil && !errors.Is(err, syscall.EPIPE) {
+		fmt.Println("err rendering webhook deliveries", err)
+	}
+}
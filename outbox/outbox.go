@@ -0,0 +1,321 @@
+// Package outbox queues items in a json file and sends them in the background, so that whatever they are sent to never
+// holds up a form. Items survive restarts, items that fail to send are retried with exponential backoff, and the
+// outbox keeps a log of recent items for the admin pages. The webhook deliveries and the mail about a form's responses
+// are both sent through an outbox.
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"mould/store"
+)
+
+// the states of an item: waiting for its next attempt, or given up on. items that were sent end up in the state their
+// outbox was opened with, e.g. "delivered"
+const (
+	Pending = "pending"
+	Failed  = "failed"
+)
+
+// logSize is how many finished items are kept in an outbox, for the log in the admin pages
+const logSize = 200
+
+// Entry is what an outbox keeps track of for each of its items, which are structs embedding an Entry
+type Entry struct {
+	ID          string     `json:"id"`
+	Created     time.Time  `json:"created"`
+	State       string     `json:"state"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	// LastResult is what came of the last attempt, e.g. the status a url answered with, or why the attempt failed
+	LastResult string `json:"last_result,omitempty"`
+}
+
+func (e *Entry) entry() *Entry {
+	return e
+}
+
+// item is a pointer to a struct embedding an Entry
+type item[T any] interface {
+	*T
+	entry() *Entry
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the error of an attempt as one that trying again won't fix, so that the item is given up on at once
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Outbox queues items of type T in a json file, and sends them in the background once started. P is *T, and is
+// inferred by Open
+type Outbox[T any, P item[T]] struct {
+	// MaxAttempts is how many times an item is attempted before giving up on it. Backoff is how long to wait before
+	// retrying an item the first time, which doubles with every retry after that, up to MaxBackoff. these must be set
+	// before the outbox is started
+	MaxAttempts         int
+	Backoff, MaxBackoff time.Duration
+
+	sent       string
+	send       func(T) (string, error)
+	mu         sync.Mutex
+	path       string
+	items      []T
+	wake, stop chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// Open opens the outbox stored at path, which sends its items with send and puts the ones that were sent in the state
+// sent. send returns what came of an attempt: e.g. a status, and an error if the attempt failed. the file is created
+// when the first item is added, and items that were still pending when the outbox was last closed are picked up again
+// once it is started
+func Open[T any, P item[T]](path, sent string, send func(item T) (result string, err error)) (*Outbox[T, P], error) {
+	o := &Outbox[T, P]{
+		MaxAttempts: 8,
+		Backoff:     time.Minute,
+		MaxBackoff:  time.Hour,
+		sent:        sent,
+		send:        send,
+		path:        path,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &o.items); err != nil {
+		return nil, fmt.Errorf("reading outbox %s: %w", path, err)
+	}
+	return o, nil
+}
+
+// NewID returns a random id for an item
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		fmt.Println("crand.Read err", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Add queues items to be sent as soon as possible, writing them to the outbox before it returns. items are given an
+// ID and a Created time if they don't have one yet
+func (o *Outbox[T, P]) Add(items ...T) error {
+	now := time.Now().UTC()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, item := range items {
+		e := P(&item).entry()
+		if e.ID == "" {
+			e.ID = NewID()
+		}
+		if e.Created.IsZero() {
+			e.Created = now
+		}
+		e.State = Pending
+		e.NextAttempt = now
+		o.items = append(o.items, item)
+	}
+	if err := o.persist(); err != nil {
+		o.items = o.items[:len(o.items)-len(items)]
+		return err
+	}
+	o.signal()
+	return nil
+}
+
+// Retry attempts an item again as soon as possible, e.g. one that was given up on, starting its attempts over
+func (o *Outbox[T, P]) Retry(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range o.items {
+		if e := P(&o.items[i]).entry(); e.ID == id {
+			e.State = Pending
+			e.Attempts = 0
+			e.NextAttempt = time.Now().UTC()
+			if err := o.persist(); err != nil {
+				return err
+			}
+			o.signal()
+			return nil
+		}
+	}
+	return fmt.Errorf("nothing in the outbox has id %q", id)
+}
+
+// Items returns the items in the outbox, newest first
+func (o *Outbox[T, P]) Items() []T {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	items := append([]T(nil), o.items...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return P(&items[i]).entry().Created.After(P(&items[j]).entry().Created)
+	})
+	return items
+}
+
+// Start sends the queued items in the background, until the outbox is closed
+func (o *Outbox[T, P]) Start() {
+	o.done = make(chan struct{})
+	go o.run()
+}
+
+// Close stops sending. items that are still pending are attempted again once the outbox is next started
+func (o *Outbox[T, P]) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.stop)
+		if o.done != nil {
+			<-o.done
+		}
+	})
+	return nil
+}
+
+func (o *Outbox[T, P]) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox[T, P]) run() {
+	defer close(o.done)
+	for {
+		// attempt everything that is due, then sleep until the next item is due or another one is added
+		o.mu.Lock()
+		now := time.Now()
+		var due []T
+		var next time.Time
+		for i := range o.items {
+			e := P(&o.items[i]).entry()
+			if e.State != Pending {
+				continue
+			}
+			if !e.NextAttempt.After(now) {
+				due = append(due, o.items[i])
+			} else if next.IsZero() || e.NextAttempt.Before(next) {
+				next = e.NextAttempt
+			}
+		}
+		o.mu.Unlock()
+		for _, item := range due {
+			select {
+			case <-o.stop:
+				return
+			default:
+			}
+			result, err := o.send(item)
+			o.record(P(&item).entry().ID, result, err)
+		}
+		if len(due) > 0 {
+			continue
+		}
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-o.stop:
+			timer.Stop()
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// record notes the outcome of an attempt, scheduling the next one if the attempt failed
+func (o *Outbox[T, P]) record(id string, result string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now().UTC()
+	var permanent permanentError
+	for i := range o.items {
+		e := P(&o.items[i]).entry()
+		if e.ID != id {
+			continue
+		}
+		e.Attempts++
+		e.LastAttempt = &now
+		e.LastResult = result
+		switch {
+		case err == nil:
+			e.State = o.sent
+		case errors.As(err, &permanent) || e.Attempts >= o.MaxAttempts:
+			e.LastResult = err.Error()
+			e.State = Failed
+		default:
+			e.LastResult = err.Error()
+			e.NextAttempt = now.Add(o.backoff(e.Attempts))
+		}
+	}
+	o.trim()
+	if err := o.persist(); err != nil {
+		fmt.Println("err persisting outbox", o.path, err)
+	}
+}
+
+// backoff is how long to wait before the next attempt, after an item failed attempts times
+func (o *Outbox[T, P]) backoff(attempts int) time.Duration {
+	wait := o.Backoff
+	for i := 1; i < attempts && wait < o.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > o.MaxBackoff {
+		wait = o.MaxBackoff
+	}
+	return wait
+}
+
+// trim drops the oldest finished items once there are more than logSize of them
+func (o *Outbox[T, P]) trim() {
+	finished := 0
+	for i := range o.items {
+		if P(&o.items[i]).entry().State != Pending {
+			finished++
+		}
+	}
+	kept := o.items[:0]
+	for i := range o.items {
+		if P(&o.items[i]).entry().State != Pending && finished > logSize {
+			finished--
+			continue
+		}
+		kept = append(kept, o.items[i])
+	}
+	o.items = kept
+}
+
+func (o *Outbox[T, P]) persist() error {
+	b, err := json.MarshalIndent(o.items, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(o.path, b, 0600)
+}
@@ -0,0 +1,87 @@
+package outbox_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mould/outbox"
+)
+
+type note struct {
+	outbox.Entry
+	Text string `json:"text"`
+}
+
+// waitFor waits for the only note in the outbox to reach state
+func waitFor(t *testing.T, notes *outbox.Outbox[note, *note], state string) note {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		items := notes.Items()
+		if len(items) == 1 && items[0].State == state {
+			return items[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the note never became %s: %+v", state, items)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// items that were queued before a restart are sent once the outbox is opened and started again
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.json")
+	notes, err := outbox.Open[note](path, "sent", func(n note) (string, error) { return "", errors.New("not started") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = notes.Add(note{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	notes.Close()
+
+	var sent atomic.Value
+	notes, err = outbox.Open[note](path, "sent", func(n note) (string, error) {
+		sent.Store(n.Text)
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes.Start()
+	defer notes.Close()
+	n := waitFor(t, notes, "sent")
+	if n.Attempts != 1 || n.LastResult != "ok" || sent.Load() != "hello" {
+		t.Errorf("got %+v sending %v, expected hello sent with 1 attempt that went ok", n, sent.Load())
+	}
+}
+
+// an item whose attempt failed permanently is given up on at once, until it's retried
+func TestPermanent(t *testing.T) {
+	var attempts int32
+	notes, err := outbox.Open[note](filepath.Join(t.TempDir(), "notes.json"), "sent", func(n note) (string, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return "", outbox.Permanent(errors.New("no such recipient"))
+		}
+		return "", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes.Backoff, notes.MaxBackoff = time.Millisecond, time.Millisecond
+	notes.Start()
+	defer notes.Close()
+	if err = notes.Add(note{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	n := waitFor(t, notes, outbox.Failed)
+	if n.Attempts != 1 || n.LastResult != "no such recipient" {
+		t.Errorf("gave up after %d attempts with %q, expected 1 attempt and the error", n.Attempts, n.LastResult)
+	}
+	if err = notes.Retry(n.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, notes, "sent")
+}
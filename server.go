@@ -5,194 +5,125 @@ import (
 	"flag"
 	"errors"
 	"os"
-	"syscall"
 	"net/http"
 	"mould/myform"
-	crand "crypto/rand"
-	"math/big"
-	"html/template"
+	"mould/mould"
+	"mould/store"
+	"mould/mailer"
 	"strings"
 	"encoding/json"
 	_ "embed"
 )
 
-type RequestHandler struct {
-}
-
-func (h RequestHandler) ErrorRoute(res http.ResponseWriter, req *http.Request) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-}
-
 //go:embed index-template.html
 var htmlContents string
 //go:embed response-template.html
 var responseContents string
 
-var responses map[string]map[string]string
-
-// used for generating a random identifier
-const characterSet = "abcdedfghijklmnopqrstABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-const pwlength = 20
-
-func generateResponseIdentifier() string {
-	var identifier strings.Builder
-	const maxChar = int64(len(characterSet))
-
-	for i := 0; i < pwlength; i++ {
-		max := big.NewInt(maxChar)
-		bigN, err := crand.Int(crand.Reader, max)
-		if err != nil {
-			fmt.Println("crand.Int err", err)
+// parseAnswer reads a posted form through the generated FormAnswer, so that the answers are checked by the typed
+// ParsePost and Validate
+func parseAnswer(form *mould.Form) func(req *http.Request) (store.Response, []mould.FieldError, error) {
+	return func(req *http.Request) (m store.Response, fieldErrors []mould.FieldError, err error) {
+		answer := myform.FormAnswer{}
+		var conversionErrors myform.FieldErrors
+		if mould.IsJSON(req) {
+			// json answers are checked against the form for their types first: decoding them straight into FormAnswer
+			// would stop at the first answer with the wrong type, and with a message that doesn't say which field it is
+			decoded, fieldErrors, err := form.DecodeAnswers(req.Body)
+			if err != nil || len(fieldErrors) > 0 {
+				return nil, fieldErrors, err
+			}
+			b, err := json.Marshal(decoded)
+			if err == nil {
+				err = json.Unmarshal(b, &answer)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		} else {
+			err = answer.ParsePost(req)
+			// answers that could not be converted to their field's type are reported together with the validation errors
+			if err != nil && !errors.As(err, &conversionErrors) {
+				return nil, nil, err
+			}
 		}
-		n := bigN.Int64()
-		identifier.WriteString(string(characterSet[n]))
-	}
-	return identifier.String()
-}
-
-func ThrowBasicAuthHeader (res http.ResponseWriter) {
-		// 1: first set the header:
-		res.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
-		// 2: the emit an error
-		http.Error(res, "Unauthorized", http.StatusUnauthorized)
-}
-
-func (h RequestHandler) IndexRoute(res http.ResponseWriter, req *http.Request) {
-	// handle 404
-	// if req.URL.Path != "/" {
-	// 	h.ErrorRoute(res, req, http.StatusNotFound)
-	// 	return
-	// }
-
-	// we have basic auth set!
-	if myform.BasicPassword != "" {
-		// try to extract user name and password from request
-		uname, pw, ok := req.BasicAuth()
-		if !ok {
-			ThrowBasicAuthHeader(res)
-			return
+		for _, fieldError := range append(conversionErrors, answer.Validate()...) {
+			fieldErrors = append(fieldErrors, mould.FieldError{Key: fieldError.Key, Message: fieldError.Message})
 		}
-		valid := (myform.BasicUser == uname && myform.BasicPassword == pw)
-		if !valid {
-			ThrowBasicAuthHeader(res)
-			return
+		if len(fieldErrors) > 0 {
+			return nil, fieldErrors, nil
 		}
-		// else: basic auth was on, and we received correct credentials: please proceed!
-	}
-	if req.Method == "POST" {
-		answer := myform.FormAnswer{}
-		// TODO (2023-09-12): include form validation in ParsePost based on required attributes
-		answer.ParsePost(req)
-		fmt.Println("received a POST")
 		// we're gonna do a lil tricky trick to get a nicer json format to persist
 		//
 		// first we marshal the answer struct into json. then we *unmarshal* it into a map, which we use to persist. this
 		// gets us a nice json representation that can live on disk and be easily manipulated with other tools, e.g. jq or
 		// little scripts
-		var b []byte
 		b, err := json.Marshal(answer)
 		if err != nil {
-			fmt.Println("marshal err", err)
-			fmt.Fprint(res, "error processing your response, it has not been persisted - sorry! contact admin")
-			return
-		} else {
-			var m map[string]string
-			err = json.Unmarshal(b, &m)
-			if err != nil {
-				fmt.Println("err when doing unmarshalling trick", err)
-				fmt.Fprint(res, "error processing your response, it has not been persisted - sorry! contact admin")
-				return
-			}
-			id := generateResponseIdentifier()
-			// make sure we have the latest data (in case external writes have happened)
-			readPersistedData()
-			// write the new entry
-			responses[id] = m
-			// persist the data, including the new entry, to disk
-			persistData()
-			// redirect to response page
-			slug := fmt.Sprintf("/responder/%s", id)
-			http.Redirect(res, req, slug, http.StatusFound)
+			return nil, nil, fmt.Errorf("marshal err: %w", err)
 		}
-	} else if req.Method == "GET" {
-		fmt.Println("GET")
-		fmt.Fprint(res, htmlContents)
+		err = json.Unmarshal(b, &m)
+		if err != nil {
+			return nil, nil, fmt.Errorf("err when doing unmarshalling trick: %w", err)
+		}
+		return m, nil, nil
 	}
 }
 
-// TODO (2023-06-02): improve json output
-const dataName = "latest-form-data.json"
-func persistData() {
-	b, err := json.MarshalIndent(responses, "", "  ")
-	if err != nil {
-		fmt.Println("failure persisting data", err)
-		return
+func Serve(port int, storeKind, storePath, tokensPath string, keepRevisions bool, smtp mailer.Config, publicURL string) {
+	// the form format was embedded in the generated package, and is served the same way as forms read at runtime
+	form, diagnostics := mould.ParseFormat("myform", myform.Source)
+	if len(diagnostics) > 0 {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+		os.Exit(1)
+	}
+	if storePath == "" {
+		storePath = store.DefaultPath(storeKind)
 	}
-	err = os.WriteFile(dataName, b, 0777)
+	responses, err := store.Open(storeKind, storePath)
 	if err != nil {
-		fmt.Println("error writing persisted form data", err)
+		fmt.Println("err opening response store", err)
+		os.Exit(1)
 	}
-}
-
-func readPersistedData() {
-	data, err := os.ReadFile(dataName)
-	if errors.Is(err, os.ErrNotExist) {
-		// no data yet probably, it's fine let's just return
-		return
+	defer responses.Close()
+	fmt.Printf("Storing responses in %s (%s)\n", storePath, storeKind)
+	handler, err := mould.NewHandler(form, htmlContents, responseContents, responses)
+	if err != nil {
+		fmt.Println("err parsing templates", err)
+		os.Exit(1)
 	}
+	handler.KeepRevisions = keepRevisions
+	handler.ParseAnswers = parseAnswer(form)
+	// payloads for the form's webhooks are queued next to the responses, so that they survive restarts
+	outbox, err := mould.OpenWebhooks(storePath)
 	if err != nil {
-		fmt.Println("error reading persisted form data", err)
-		return
+		fmt.Println("err opening webhook outbox", err)
+		os.Exit(1)
 	}
-	var temp map[string]map[string]string
-	// unmarshal into a temp map to make sure keys that are deleted on disk, but not in the map `responses`, are
-	// correctly kept deleted. Unmarshal's behaviour is to keep the existing keys of a map, not to reallocate a new map
-	// and fill with the new values being unmarshalled
-	err = json.Unmarshal(data, &temp)
-	responses = temp
+	defer outbox.Close()
+	handler.Webhooks = outbox
+	// and so is mail, if there's an smtp server to send it through
+	mail, err := mould.OpenMail(storePath, smtp)
 	if err != nil {
-		fmt.Println("error unmarshalling persisted form data", err)
-		return
+		fmt.Println("err opening mail outbox", err)
+		os.Exit(1)
+	}
+	if mail != nil {
+		defer mail.Close()
+	}
+	if warning := form.MailWarning(mail, publicURL); warning != "" {
+		fmt.Println(warning)
+	}
+	handler.Mail = mail
+	handler.PublicURL = publicURL
+	if handler.APITokens, err = mould.ReadTokensFile(tokensPath); err != nil {
+		fmt.Println("err reading api tokens", err)
+		os.Exit(1)
 	}
-}
-
-func Serve(port int) {
-	handler := RequestHandler{}
-	responses = make(map[string]map[string]string)
-	readPersistedData()
 
-	http.HandleFunc("/responder/", func(res http.ResponseWriter, req *http.Request) {
-		id := strings.TrimPrefix(req.URL.Path, "/responder/")
-		// response was not recorded
-		if _, ok := responses[id]; !ok {
-			fmt.Fprint(res, "No such form responder id")
-			return
-		}
-		// let's make sure to read the on-disk data and refresh the `responses` map, in case it has been hand-edited
-		// (hand-editing after the fact could allow for updating a "processed" flag, signaling to the form responder
-		// that e.g. their order has now been processed)
-		readPersistedData()
-		if val, ok := responses[id]; ok {
-			niceJSON, err := json.MarshalIndent(val, "", "  ")
-			if err != nil {
-				fmt.Printf("err marshalling stored value for id %s\n", id)
-				fmt.Fprint(res, "Had an error when formatting your stored response for web purposes. Contact admin")
-				return
-			}
-			t := template.Must(template.New("").Parse(responseContents))
-			err = t.Execute(res, myform.ResponderData{string(niceJSON)})
-			if errors.Is(err, syscall.EPIPE) {
-				fmt.Println("recovering from broken pipe")
-				return
-			} else if err != nil {
-				fmt.Println("err rendering reponder view", err)
-			}
-		} else {
-			fmt.Fprint(res, "No such form responder id")
-			return
-		}
-	})
-	http.HandleFunc("/", handler.IndexRoute)
+	http.Handle("/", handler)
 
 	// fileserver := http.FileServer(http.Dir("html/assets/"))
 	// s.ServeMux.Handle("/assets/", http.StripPrefix("/assets/", fileserver))
@@ -204,7 +135,16 @@ func Serve(port int) {
 
 func main () {
 	var port int
+	var storeKind, storePath, tokensPath string
+	var keepRevisions bool
+	var smtp mailer.Config
+	var publicURL string
 	flag.IntVar(&port, "port", 7272, "the port to serve the form server on")
+	flag.StringVar(&storeKind, "store", "json", fmt.Sprintf("how responses are stored, one of %s", strings.Join(store.Kinds, ", ")))
+	flag.StringVar(&storePath, "store-path", "", "the file responses are stored in (default depends on --store: latest-form-data.json, form-data.jsonl or form-data.sqlite)")
+	flag.BoolVar(&keepRevisions, "revisions", true, "keep the earlier answers of a response when it is changed, so its history can be seen in the admin pages")
+	flag.StringVar(&tokensPath, "api-tokens", "", "a file of api tokens, one per line, that give access to the responses at /api/ along with the form's form-api-tokens")
+	mould.MailFlags(flag.CommandLine, &smtp, &publicURL)
 	flag.Parse()
-	Serve(port)
+	Serve(port, storeKind, storePath, tokensPath, keepRevisions, smtp, publicURL)
 }
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONStore keeps all responses in a single json object, mapping ids to responses, which is rewritten in full on
+// every change. This makes for a file that is easy to read and to edit with other tools, e.g. jq or little scripts, and
+// the file is read again before every operation so that any such edits are picked up.
+type JSONStore struct {
+	mu        sync.Mutex
+	path      string
+	responses map[string]Response
+}
+
+func OpenJSON(path string) (*JSONStore, error) {
+	s := &JSONStore{path: path, responses: make(map[string]Response)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONStore) Put(id string, response Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// make sure we have the latest data (in case external writes have happened)
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, exists := s.responses[id]; exists {
+		return ErrExists
+	}
+	s.responses[id] = response.clone()
+	if err := s.persist(); err != nil {
+		delete(s.responses, id)
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) Get(id string) (Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// let's make sure to read the on-disk data, in case it has been hand-edited (hand-editing after the fact could allow
+	// for updating a "processed" flag, signaling to the form responder that e.g. their order has now been processed)
+	if err := s.load(); err != nil {
+		fmt.Println("error reading persisted form data", err)
+	}
+	response, ok := s.responses[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return response.clone(), nil
+}
+
+func (s *JSONStore) List() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		fmt.Println("error reading persisted form data", err)
+	}
+	entries := sortedEntries(s.responses)
+	for i := range entries {
+		entries[i].Response = entries[i].Response.clone()
+	}
+	return entries, nil
+}
+
+func (s *JSONStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	response, ok := s.responses[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.responses, id)
+	if err := s.persist(); err != nil {
+		s.responses[id] = response
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) Update(id string, update func(Response) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	previous, ok := s.responses[id]
+	if !ok {
+		return ErrNotFound
+	}
+	response := previous.clone()
+	if err := update(response); err != nil {
+		return err
+	}
+	s.responses[id] = response
+	if err := s.persist(); err != nil {
+		s.responses[id] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// load replaces the responses held in memory with those on disk. if the file can't be parsed, e.g. because it is in
+// the middle of being hand-edited, the responses in memory are kept. the caller must hold s.mu
+func (s *JSONStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// no data yet probably, it's fine let's just return
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var temp map[string]Response
+	// unmarshal into a temp map to make sure keys that are deleted on disk, but not in the map `responses`, are
+	// correctly kept deleted. Unmarshal's behaviour is to keep the existing keys of a map, not to reallocate a new map
+	// and fill with the new values being unmarshalled
+	err = json.Unmarshal(data, &temp)
+	if err != nil {
+		return fmt.Errorf("unmarshalling %s: %w", s.path, err)
+	}
+	if temp == nil {
+		temp = make(map[string]Response)
+	}
+	s.responses = temp
+	return nil
+}
+
+// persist writes all responses to disk. the caller must hold s.mu
+func (s *JSONStore) persist() error {
+	b, err := json.MarshalIndent(s.responses, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.path, b, 0644)
+}
+
+// WriteFileAtomic writes data to a temporary file next to path, syncs it, and then renames it over path. a crash
+// midway leaves either the old or the new contents on disk, never a truncated file
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// clean up the temporary file if anything fails before the rename
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// sync the directory as well, so that the rename itself survives a crash
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// JSONLStore appends every change as a single line of json to a log file, instead of rewriting all responses on each
+// submission. The log is replayed when the store is opened, after which the responses are served from memory; unlike
+// JSONStore, the file is not meant to be edited while the server is running.
+type JSONLStore struct {
+	mu        sync.Mutex
+	file      *os.File
+	responses map[string]Response
+}
+
+// logLine is a single line of the log: either a new version of a response ("put"), or its removal ("delete")
+type logLine struct {
+	Op       string   `json:"op"`
+	ID       string   `json:"id"`
+	Response Response `json:"response,omitempty"`
+}
+
+func OpenJSONL(path string) (*JSONLStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &JSONLStore{file: file, responses: make(map[string]Response)}
+	if err = s.replay(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("replaying %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// replay rebuilds the responses from the log. a crash in the middle of an append can leave a partial line at the very
+// end of the log; it is cut off, so that the next append starts on a line of its own
+func (s *JSONLStore) replay() error {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	for lineno := 1; ; lineno++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				fmt.Printf("dropping incomplete last line %d of the response log\n", lineno)
+				if err = s.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry logLine
+		if err = json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("line %d: %w", lineno, err)
+		}
+		switch entry.Op {
+		case "put":
+			s.responses[entry.ID] = entry.Response
+		case "delete":
+			delete(s.responses, entry.ID)
+		default:
+			return fmt.Errorf("line %d: unknown op %q", lineno, entry.Op)
+		}
+	}
+	_, err := s.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+// appendLine writes a line to the end of the log and syncs it to disk. the caller must hold s.mu
+func (s *JSONLStore) appendLine(entry logLine) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err = s.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *JSONLStore) Put(id string, response Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.responses[id]; exists {
+		return ErrExists
+	}
+	if err := s.appendLine(logLine{Op: "put", ID: id, Response: response}); err != nil {
+		return err
+	}
+	s.responses[id] = response.clone()
+	return nil
+}
+
+func (s *JSONLStore) Get(id string) (Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response, ok := s.responses[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return response.clone(), nil
+}
+
+func (s *JSONLStore) List() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := sortedEntries(s.responses)
+	for i := range entries {
+		entries[i].Response = entries[i].Response.clone()
+	}
+	return entries, nil
+}
+
+func (s *JSONLStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.responses[id]; !ok {
+		return ErrNotFound
+	}
+	if err := s.appendLine(logLine{Op: "delete", ID: id}); err != nil {
+		return err
+	}
+	delete(s.responses, id)
+	return nil
+}
+
+func (s *JSONLStore) Update(id string, update func(Response) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.responses[id]
+	if !ok {
+		return ErrNotFound
+	}
+	response := previous.clone()
+	if err := update(response); err != nil {
+		return err
+	}
+	if err := s.appendLine(logLine{Op: "put", ID: id, Response: response}); err != nil {
+		return err
+	}
+	s.responses[id] = response
+	return nil
+}
+
+func (s *JSONLStore) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"sync"
+)
+
+// MemoryStore keeps responses in memory only, so they are gone once the program exits. It's meant for trying a form
+// out, and for programs that embed a form and look after its responses themselves
+type MemoryStore struct {
+	mu        sync.Mutex
+	responses map[string]Response
+}
+
+func NewMemory() *MemoryStore {
+	return &MemoryStore{responses: make(map[string]Response)}
+}
+
+func (s *MemoryStore) Put(id string, response Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.responses[id]; exists {
+		return ErrExists
+	}
+	s.responses[id] = response.clone()
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response, ok := s.responses[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return response.clone(), nil
+}
+
+func (s *MemoryStore) List() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := sortedEntries(s.responses)
+	for i := range entries {
+		entries[i].Response = entries[i].Response.clone()
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.responses[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.responses, id)
+	return nil
+}
+
+func (s *MemoryStore) Update(id string, update func(Response) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.responses[id]
+	if !ok {
+		return ErrNotFound
+	}
+	response := previous.clone()
+	if err := update(response); err != nil {
+		return err
+	}
+	s.responses[id] = response
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
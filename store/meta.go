@@ -0,0 +1,86 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Meta is what is known about a response apart from its answers. It is stored under MetaKey, next to the answers, so
+// that the stored data stays a flat map of answers that is easy to work with in e.g. jq
+type Meta struct {
+	Created time.Time  `json:"created"`
+	Updated *time.Time `json:"updated,omitempty"`
+	// FormHash identifies the version of the form definition the answers were given to
+	FormHash  string     `json:"form_hash,omitempty"`
+	Revisions []Revision `json:"revisions,omitempty"`
+	// Status is the history of the response's status, oldest first, for forms that declare statuses
+	Status []StatusChange `json:"status,omitempty"`
+}
+
+// StatusChange is a response being moved to one of its form's statuses
+type StatusChange struct {
+	Status  string    `json:"status"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// CurrentStatus returns the status the response was last moved to, or "" if it has none
+func (m Meta) CurrentStatus() string {
+	if len(m.Status) == 0 {
+		return ""
+	}
+	return m.Status[len(m.Status)-1].Status
+}
+
+// Revision is an earlier version of a response's answers, kept when the response was changed
+type Revision struct {
+	// Replaced is when these answers were replaced by newer ones
+	Replaced time.Time `json:"replaced"`
+	// By is who made the change that replaced these answers, e.g. "admin"
+	By       string                 `json:"by,omitempty"`
+	FormHash string                 `json:"form_hash,omitempty"`
+	Answers  map[string]interface{} `json:"answers"`
+}
+
+// Meta returns the response's metadata. Responses stored before metadata was kept have none, and get the zero Meta
+func (r Response) Meta() Meta {
+	var meta Meta
+	if raw, ok := r[MetaKey]; ok {
+		// the metadata is stored as a plain map, as that is what it will be after being read from disk anyway
+		if b, err := json.Marshal(raw); err == nil {
+			json.Unmarshal(b, &meta)
+		}
+	}
+	return meta
+}
+
+func (r Response) SetMeta(meta Meta) {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	var raw map[string]interface{}
+	if err = json.Unmarshal(b, &raw); err == nil {
+		r[MetaKey] = raw
+	}
+}
+
+// Answers returns a copy of the response without its metadata
+func (r Response) Answers() Response {
+	answers := r.clone()
+	delete(answers, MetaKey)
+	return answers
+}
+
+// Revise records that the response's answers are about to be replaced, by who and against which version of the form.
+// The updated time is always set, while the current answers are only added to the revision history if keepRevision
+// is set
+func (r Response) Revise(now time.Time, by, formHash string, keepRevision bool) {
+	meta := r.Meta()
+	if keepRevision {
+		meta.Revisions = append(meta.Revisions, Revision{Replaced: now, By: by, FormHash: meta.FormHash, Answers: r.Answers()})
+	}
+	meta.Updated = &now
+	meta.FormHash = formHash
+	r.SetMeta(meta)
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore keeps each response as a row in an embedded sqlite database, with the response itself stored as json.
+// Changes only touch the row they concern, and the database can be queried with sqlite's json functions, e.g.
+// `select json_extract(data, '$.name') from responses`.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS responses (
+	id TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+)`
+
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	// wait for locks rather than failing immediately, should another connection be writing, and take the write lock at
+	// the start of a transaction so that Update never has to upgrade a read lock mid-way
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Put(id string, response Response) error {
+	b, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Exec(`INSERT INTO responses (id, data) VALUES (?, ?) ON CONFLICT (id) DO NOTHING`, id, string(b))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrExists
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Get(id string) (Response, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM responses WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var response Response
+	err = json.Unmarshal([]byte(data), &response)
+	return response, err
+}
+
+func (s *SQLiteStore) List() ([]Entry, error) {
+	rows, err := s.db.Query(`SELECT id, data FROM responses ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		var data string
+		if err = rows.Scan(&entry.ID, &data); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(data), &entry.Response); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLiteStore) Delete(id string) error {
+	result, err := s.db.Exec(`DELETE FROM responses WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Update(id string, update func(Response) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	// rolling back after a successful commit is a no-op
+	defer tx.Rollback()
+	var data string
+	err = tx.QueryRow(`SELECT data FROM responses WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	var response Response
+	if err = json.Unmarshal([]byte(data), &response); err != nil {
+		return err
+	}
+	if err = update(response); err != nil {
+		return err
+	}
+	b, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE responses SET data = ? WHERE id = ?`, string(b), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
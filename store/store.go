@@ -0,0 +1,109 @@
+// Package store persists the responses of a form. Responses are kept as the json representation of the generated
+// FormAnswer, i.e. a map from each field's key to its answer, and are identified by the random id that respondents
+// use to get back to their response.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrNotFound = errors.New("no such response")
+	ErrExists   = errors.New("a response with that id already exists")
+)
+
+// MetaKey is the key under which data about a response, rather than its answers, is stored, e.g. when it was submitted
+const MetaKey = "_meta"
+
+// Response is a single response to the form, keyed by each field's key
+type Response map[string]interface{}
+
+// Entry is a stored response together with its id
+type Entry struct {
+	ID       string
+	Response Response
+}
+
+// Store is implemented by each of the storage backends. All of its methods are safe to call from several goroutines
+// at once.
+type Store interface {
+	// Put stores a new response under id, failing with ErrExists if the id is already in use
+	Put(id string, response Response) error
+	// Get returns the response stored under id, or ErrNotFound
+	Get(id string) (Response, error)
+	// List returns all stored responses, ordered by id
+	List() ([]Entry, error)
+	// Delete removes the response stored under id, or returns ErrNotFound
+	Delete(id string) error
+	// Update calls update with a copy of the response stored under id and, unless update returns an error, stores the
+	// modified copy. Nothing else can modify the response while update runs
+	Update(id string, update func(Response) error) error
+	Close() error
+}
+
+// Kinds lists the storage backends that can be passed to Open
+var Kinds = []string{"json", "jsonl", "sqlite"}
+
+// DefaultPath returns the file a backend stores its data in, unless told otherwise
+func DefaultPath(kind string) string {
+	switch kind {
+	case "jsonl":
+		return "form-data.jsonl"
+	case "sqlite":
+		return "form-data.sqlite"
+	default:
+		return "latest-form-data.json"
+	}
+}
+
+// Open opens the storage backend of the given kind, which stores its data at path
+func Open(kind, path string) (Store, error) {
+	switch kind {
+	case "json":
+		return OpenJSON(path)
+	case "jsonl":
+		return OpenJSONL(path)
+	case "sqlite":
+		return OpenSQLite(path)
+	}
+	return nil, fmt.Errorf("unknown store %q: expected one of %v", kind, Kinds)
+}
+
+// clone copies a response, along with the lists and objects in it, so that changing the copy leaves r as it was
+func (r Response) clone() Response {
+	c := make(Response, len(r))
+	for k, v := range r {
+		c[k] = cloneValue(v)
+	}
+	return c
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = cloneValue(item)
+		}
+		return c
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			c[k] = cloneValue(item)
+		}
+		return c
+	}
+	return v
+}
+
+// sortedEntries turns a map of responses into a list ordered by id
+func sortedEntries(responses map[string]Response) []Entry {
+	entries := make([]Entry, 0, len(responses))
+	for id, response := range responses {
+		entries = append(entries, Entry{ID: id, Response: response})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
@@ -0,0 +1,137 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"mould/store"
+)
+
+// backend opens a store. reopen is set for the stores that keep their responses on disk, which are opened again to
+// check that they are still there
+type backend struct {
+	name   string
+	open   func() (store.Store, error)
+	reopen bool
+}
+
+func backends(t *testing.T) []backend {
+	list := []backend{{name: "memory", open: func() (store.Store, error) { return store.NewMemory(), nil }}}
+	for _, kind := range store.Kinds {
+		path := filepath.Join(t.TempDir(), "responses"+filepath.Ext(store.DefaultPath(kind)))
+		kind := kind
+		list = append(list, backend{name: kind, open: func() (store.Store, error) { return store.Open(kind, path) }, reopen: true})
+	}
+	return list
+}
+
+func sticker(name string) store.Response {
+	return store.Response{"name": name, "amount": float64(2), "toppings": []interface{}{"cheese", "olives"}, "terms": true}
+}
+
+func get(t *testing.T, s store.Store, id string) store.Response {
+	t.Helper()
+	response, err := s.Get(id)
+	if err != nil {
+		t.Fatalf("get %s: %s", id, err)
+	}
+	return response
+}
+
+// every backend behaves the same way, from Put to Delete, and the responses they return are their own copies
+func TestConformance(t *testing.T) {
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			s, err := b.open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { s.Close() }()
+
+			put := sticker("Ada")
+			if err = s.Put("b", put); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.Put("b", sticker("Grace")); !errors.Is(err, store.ErrExists) {
+				t.Errorf("putting an id twice: got %v, expected ErrExists", err)
+			}
+			if err = s.Put("a", sticker("Grace")); err != nil {
+				t.Fatal(err)
+			}
+			if got := get(t, s, "b"); !reflect.DeepEqual(got, sticker("Ada")) {
+				t.Errorf("got %v, expected %v", got, sticker("Ada"))
+			}
+
+			// changing what was put, or what was got, doesn't change what is stored
+			put["name"] = "changed"
+			put["toppings"].([]interface{})[0] = "changed"
+			got := get(t, s, "b")
+			got["name"] = "changed"
+			got["toppings"].([]interface{})[1] = "changed"
+			if got := get(t, s, "b"); !reflect.DeepEqual(got, sticker("Ada")) {
+				t.Errorf("changing the maps passed to Put and returned by Get changed the stored response to %v", got)
+			}
+
+			err = s.Update("b", func(r store.Response) error {
+				r["name"] = "Ada Lovelace"
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			failed := errors.New("never mind")
+			err = s.Update("b", func(r store.Response) error {
+				r["name"] = "not stored"
+				return failed
+			})
+			if !errors.Is(err, failed) {
+				t.Errorf("got %v from an update that failed, expected its error", err)
+			}
+			if err = s.Update("missing", func(store.Response) error { return nil }); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("updating a missing response: got %v, expected ErrNotFound", err)
+			}
+			expected := sticker("Ada Lovelace")
+			if got := get(t, s, "b"); !reflect.DeepEqual(got, expected) {
+				t.Errorf("got %v after updating, expected %v", got, expected)
+			}
+
+			if err = s.Put("c", sticker("Margaret")); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.Delete("c"); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.Delete("c"); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("deleting twice: got %v, expected ErrNotFound", err)
+			}
+			if _, err = s.Get("c"); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("getting a deleted response: got %v, expected ErrNotFound", err)
+			}
+
+			check := func(s store.Store) {
+				t.Helper()
+				entries, err := s.List()
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected := []store.Entry{{ID: "a", Response: sticker("Grace")}, {ID: "b", Response: sticker("Ada Lovelace")}}
+				if !reflect.DeepEqual(entries, expected) {
+					t.Errorf("listed %v, expected %v", entries, expected)
+				}
+			}
+			check(s)
+			if !b.reopen {
+				return
+			}
+			if err = s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if s, err = b.open(); err != nil {
+				t.Fatal(err)
+			}
+			check(s)
+		})
+	}
+}
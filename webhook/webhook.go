@@ -0,0 +1,124 @@
+// Package webhook posts signed json payloads about a form's responses to the urls declared with form-webhook. Every
+// delivery is written to an outbox file before it is attempted, so that deliveries survive restarts, and deliveries
+// that fail are retried with exponential backoff. The outbox also keeps a log of recent deliveries for the admin pages.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"mould/outbox"
+)
+
+// the headers every delivery is posted with, besides Content-Type. SignatureHeader is "sha256=" followed by the hex
+// encoded HMAC-SHA256 of the request body, keyed with the form's form-webhook-secret
+const (
+	SignatureHeader = "X-Mould-Signature"
+	EventHeader     = "X-Mould-Event"
+	DeliveryHeader  = "X-Mould-Delivery"
+)
+
+// the states of a delivery: waiting for its next attempt, received by its url, or given up on after MaxAttempts
+const (
+	Pending   = outbox.Pending
+	Delivered = "delivered"
+	Failed    = outbox.Failed
+)
+
+// Delivery is a payload to be posted to one url. its LastResult is the status code the url answered the last attempt
+// with, or why the attempt failed
+type Delivery struct {
+	outbox.Entry
+	URL   string `json:"url"`
+	Event string `json:"event"`
+	// ResponseID is the response the payload is about
+	ResponseID string `json:"response_id"`
+	// Payload is kept as a string rather than as json, so that it is sent byte for byte the way it was signed. it is
+	// signed when it is queued, so that the secret itself is never written to the outbox
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// Outbox queues deliveries in a json file, and delivers them in the background once started. like the attempts and
+// backoff of the outbox, Client must be set before it is started
+type Outbox struct {
+	*outbox.Outbox[Delivery, *Delivery]
+	Client *http.Client
+}
+
+// Open opens the outbox stored at path, which is created when the first delivery is queued. deliveries that were
+// still pending when the outbox was last closed are picked up again once it is started
+func Open(path string) (*Outbox, error) {
+	o := &Outbox{Client: &http.Client{Timeout: 10 * time.Second}}
+	queue, err := outbox.Open[Delivery](path, Delivered, o.send)
+	if err != nil {
+		return nil, err
+	}
+	queue.Backoff = 30 * time.Second
+	o.Outbox = queue
+	return o, nil
+}
+
+// Sign signs a payload with secret, the way the SignatureHeader of its delivery is
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature, the SignatureHeader of a delivery, is the signature of payload, for receivers
+func Verify(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
+
+// Enqueue queues a payload about a response to be posted to each of urls, signed with secret. the deliveries are
+// written to the outbox before Enqueue returns
+func (o *Outbox) Enqueue(event, responseID string, payload []byte, urls []string, secret string) error {
+	signature := Sign(secret, payload)
+	var deliveries []Delivery
+	for _, url := range urls {
+		deliveries = append(deliveries, Delivery{
+			URL:        url,
+			Event:      event,
+			ResponseID: responseID,
+			Payload:    string(payload),
+			Signature:  signature,
+		})
+	}
+	return o.Add(deliveries...)
+}
+
+// Deliveries returns the deliveries in the outbox, newest first
+func (o *Outbox) Deliveries() []Delivery {
+	return o.Items()
+}
+
+// send attempts a delivery, returning why it failed if it did
+func (o *Outbox) send(d Delivery) (result string, err error) {
+	req, err := http.NewRequest("POST", d.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mould-webhook")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set(SignatureHeader, d.Signature)
+	res, err := o.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	result = res.Status
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return result, fmt.Errorf("%s", res.Status)
+	}
+	return result, nil
+}
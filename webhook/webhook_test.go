@@ -0,0 +1,171 @@
+package webhook_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mould/webhook"
+)
+
+const secret = "0123456789abcdef0123"
+
+// receiver is a webhook url that answers the first failures deliveries it gets with a 500, and remembers every request
+type receiver struct {
+	*httptest.Server
+	failures int
+
+	mu       sync.Mutex
+	requests []request
+}
+
+type request struct {
+	received time.Time
+	header   http.Header
+	body     []byte
+}
+
+func newReceiver(t *testing.T, failures int) *receiver {
+	r := &receiver{failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, request{received: time.Now(), header: req.Header, body: body})
+		failed := len(r.requests) <= r.failures
+		r.mu.Unlock()
+		if failed {
+			http.Error(res, "not now", http.StatusInternalServerError)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() []request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]request(nil), r.requests...)
+}
+
+// open opens and starts an outbox in a temporary directory, with the attempts and backoff to test with
+func open(t *testing.T, maxAttempts int, backoff, maxBackoff time.Duration) *webhook.Outbox {
+	outbox, err := webhook.Open(filepath.Join(t.TempDir(), "responses.json.webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox.MaxAttempts, outbox.Backoff, outbox.MaxBackoff = maxAttempts, backoff, maxBackoff
+	outbox.Start()
+	t.Cleanup(func() { outbox.Close() })
+	return outbox
+}
+
+// waitFor waits for the only delivery in the outbox to reach state
+func waitFor(t *testing.T, outbox *webhook.Outbox, state string) webhook.Delivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := outbox.Deliveries()
+		if len(deliveries) == 1 && deliveries[0].State == state {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the delivery never became %s: %+v", state, deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// a delivery is posted as it was queued, with a signature the receiver can check with the secret
+func TestSignature(t *testing.T) {
+	r := newReceiver(t, 0)
+	outbox := open(t, 8, time.Minute, time.Hour)
+	payload := `{"event":"response.created","response_id":"abc"}`
+	if err := outbox.Enqueue("response.created", "abc", []byte(payload), []string{r.URL}, secret); err != nil {
+		t.Fatal(err)
+	}
+	delivery := waitFor(t, outbox, webhook.Delivered)
+
+	requests := r.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, expected 1", len(requests))
+	}
+	req := requests[0]
+	if string(req.body) != payload {
+		t.Errorf("got payload %s, expected %s", req.body, payload)
+	}
+	signature := req.header.Get(webhook.SignatureHeader)
+	if !webhook.Verify(secret, req.body, signature) {
+		t.Errorf("signature %q doesn't verify", signature)
+	}
+	if webhook.Verify("another secret, just as long", req.body, signature) {
+		t.Errorf("signature %q verifies with the wrong secret", signature)
+	}
+	if webhook.Verify(secret, []byte(strings.Replace(payload, "abc", "abd", 1)), signature) {
+		t.Errorf("signature %q verifies a changed payload", signature)
+	}
+	if event := req.header.Get(webhook.EventHeader); event != "response.created" {
+		t.Errorf("got event %q, expected response.created", event)
+	}
+	if id := req.header.Get(webhook.DeliveryHeader); id != delivery.ID {
+		t.Errorf("got delivery id %q, expected %q", id, delivery.ID)
+	}
+}
+
+// failed deliveries are retried, waiting twice as long after every failure up to the maximum backoff
+func TestRetries(t *testing.T) {
+	const backoff = 40 * time.Millisecond
+	r := newReceiver(t, 4)
+	outbox := open(t, 8, backoff, 2*backoff)
+	if err := outbox.Enqueue("response.created", "abc", []byte(`{}`), []string{r.URL}, secret); err != nil {
+		t.Fatal(err)
+	}
+	delivery := waitFor(t, outbox, webhook.Delivered)
+	if delivery.Attempts != 5 {
+		t.Errorf("delivered after %d attempts, expected 5", delivery.Attempts)
+	}
+
+	requests := r.received()
+	if len(requests) != 5 {
+		t.Fatalf("got %d requests, expected 5", len(requests))
+	}
+	for i, wait := range []time.Duration{backoff, 2 * backoff, 2 * backoff, 2 * backoff} {
+		if waited := requests[i+1].received.Sub(requests[i].received); waited < wait {
+			t.Errorf("attempt %d came %s after the one before, expected at least %s", i+2, waited, wait)
+		}
+		if requests[i+1].header.Get(webhook.SignatureHeader) != requests[0].header.Get(webhook.SignatureHeader) {
+			t.Errorf("attempt %d was signed differently", i+2)
+		}
+	}
+	// without MaxBackoff, the last attempt would have waited 8 times the backoff
+	if waited := requests[4].received.Sub(requests[3].received); waited >= 4*backoff {
+		t.Errorf("the last attempt came %s after the one before, expected the backoff to stop at %s", waited, 2*backoff)
+	}
+}
+
+// a delivery is given up on after MaxAttempts, until it's retried by hand
+func TestGiveUp(t *testing.T) {
+	r := newReceiver(t, 3)
+	outbox := open(t, 2, time.Millisecond, time.Millisecond)
+	if err := outbox.Enqueue("response.deleted", "abc", []byte(`{}`), []string{r.URL}, secret); err != nil {
+		t.Fatal(err)
+	}
+	delivery := waitFor(t, outbox, webhook.Failed)
+	if delivery.Attempts != 2 || !strings.Contains(delivery.LastResult, "500") {
+		t.Errorf("gave up after %d attempts with %q, expected 2 attempts ending in a 500", delivery.Attempts, delivery.LastResult)
+	}
+
+	if err := outbox.Retry(delivery.ID); err != nil {
+		t.Fatal(err)
+	}
+	// the third request fails too, which is the first attempt of the retry, and the fourth goes through
+	delivery = waitFor(t, outbox, webhook.Delivered)
+	if delivery.Attempts != 2 || len(r.received()) != 4 {
+		t.Errorf("delivered after %d attempts and %d requests, expected 2 and 4", delivery.Attempts, len(r.received()))
+	}
+}